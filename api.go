@@ -18,6 +18,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const APIVERSION = 1.4
@@ -131,8 +132,18 @@ func postContainersKill(srv *Server, version float64, w http.ResponseWriter, r *
 	if vars == nil {
 		return fmt.Errorf("Missing parameter")
 	}
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	sig := 0
+	if value := r.Form.Get("signal"); value != "" {
+		var err error
+		if sig, err = parseSignal(value); err != nil {
+			return fmt.Errorf("Bad parameter: %s", err)
+		}
+	}
 	name := vars["name"]
-	if err := srv.ContainerKill(name); err != nil {
+	if err := srv.ContainerKill(name, sig); err != nil {
 		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -162,8 +173,12 @@ func getImagesJSON(srv *Server, version float64, w http.ResponseWriter, r *http.
 		return err
 	}
 	filter := r.Form.Get("filter")
+	filters, err := parseFilters(r.Form.Get("filters"), imageFilters...)
+	if err != nil {
+		return err
+	}
 
-	outs, err := srv.Images(all, filter)
+	outs, err := srv.Images(all, filter, filters)
 	if err != nil {
 		return err
 	}
@@ -213,6 +228,10 @@ func getEvents(srv *Server, version float64, w http.ResponseWriter, r *http.Requ
 	if err := parseForm(r); err != nil {
 		return err
 	}
+	filters, err := parseFilters(r.Form.Get("filters"), eventFilters...)
+	if err != nil {
+		return err
+	}
 	listener := make(chan utils.JSONMessage)
 	srv.Lock()
 	srv.listeners[r.RemoteAddr] = listener
@@ -226,7 +245,7 @@ func getEvents(srv *Server, version float64, w http.ResponseWriter, r *http.Requ
 	if since != 0 {
 		// If since, send previous events that happened after the timestamp
 		for _, event := range srv.events {
-			if event.Time >= since {
+			if event.Time >= since && filters.matchLabels(event.Labels) {
 				err := sendEvent(wf, &event)
 				if err != nil && err.Error() == "JSON error" {
 					continue
@@ -238,6 +257,9 @@ func getEvents(srv *Server, version float64, w http.ResponseWriter, r *http.Requ
 		}
 	}
 	for event := range listener {
+		if !filters.matchLabels(event.Labels) {
+			continue
+		}
 		err := sendEvent(wf, &event)
 		if err != nil && err.Error() == "JSON error" {
 			continue
@@ -307,6 +329,44 @@ func getContainersTop(srv *Server, version float64, w http.ResponseWriter, r *ht
 	return nil
 }
 
+func getContainersStats(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	stream := true
+	if r.Form.Get("stream") != "" {
+		var err error
+		if stream, err = getBoolParam(r.Form.Get("stream")); err != nil {
+			return err
+		}
+	}
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	name := vars["name"]
+	stats, err := srv.ContainerStats(name)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(utils.NewWriteFlusher(w))
+	for {
+		if err := enc.Encode(stats); err != nil {
+			return err
+		}
+		if !stream {
+			return nil
+		}
+		time.Sleep(time.Second)
+		// The stream ends with the container
+		if stats, err = srv.ContainerStats(name); err != nil {
+			utils.Debugf("End of stats stream: %s", err)
+			return nil
+		}
+	}
+}
+
 func getContainersJSON(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 	if err := parseForm(r); err != nil {
 		return err
@@ -325,8 +385,15 @@ func getContainersJSON(srv *Server, version float64, w http.ResponseWriter, r *h
 	if err != nil {
 		n = -1
 	}
+	filters, err := parseFilters(r.Form.Get("filters"), containerFilters...)
+	if err != nil {
+		return err
+	}
 
-	outs := srv.Containers(all, size, n, since, before)
+	outs, err := srv.Containers(all, size, n, since, before, filters)
+	if err != nil {
+		return err
+	}
 	b, err := json.Marshal(outs)
 	if err != nil {
 		return err
@@ -370,7 +437,11 @@ func postCommit(srv *Server, version float64, w http.ResponseWriter, r *http.Req
 	container := r.Form.Get("container")
 	author := r.Form.Get("author")
 	comment := r.Form.Get("comment")
-	id, err := srv.ContainerCommit(container, repo, tag, author, comment, config)
+	pause, err := getBoolParam(r.Form.Get("pause"))
+	if err != nil {
+		return err
+	}
+	id, err := srv.ContainerCommit(container, repo, tag, author, comment, pause, config)
 	if err != nil {
 		return err
 	}
@@ -506,6 +577,9 @@ func postImagesPush(srv *Server, version float64, w http.ResponseWriter, r *http
 }
 
 func postContainersCreate(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
 	config := &Config{}
 	out := &APIRun{}
 
@@ -523,7 +597,7 @@ func postContainersCreate(srv *Server, version float64, w http.ResponseWriter, r
 		config.Dns = defaultDns
 	}
 
-	id, err := srv.ContainerCreate(config)
+	id, err := srv.ContainerCreate(config, r.Form.Get("name"))
 	if err != nil {
 		return err
 	}
@@ -538,6 +612,11 @@ func postContainersCreate(srv *Server, version float64, w http.ResponseWriter, r
 		out.Warnings = append(out.Warnings, "Your kernel does not support memory swap capabilities. Limitation discarded.")
 	}
 
+	for _, warning := range discardUnsupportedLimits(config, srv.runtime.capabilities) {
+		log.Println("WARNING: " + warning)
+		out.Warnings = append(out.Warnings, warning)
+	}
+
 	if srv.runtime.capabilities.IPv4ForwardingDisabled {
 		log.Println("Warning: IPv4 forwarding is disabled.")
 		out.Warnings = append(out.Warnings, "IPv4 forwarding is disabled.")
@@ -571,6 +650,21 @@ func postContainersRestart(srv *Server, version float64, w http.ResponseWriter,
 	return nil
 }
 
+func postContainersRename(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	name := vars["name"]
+	if err := srv.ContainerRename(name, r.Form.Get("name")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func deleteContainers(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 	if err := parseForm(r); err != nil {
 		return err
@@ -663,6 +757,28 @@ func postContainersStop(srv *Server, version float64, w http.ResponseWriter, r *
 	return nil
 }
 
+func postContainersPause(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	if err := srv.ContainerPause(vars["name"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func postContainersUnpause(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	if err := srv.ContainerUnpause(vars["name"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func postContainersWait(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 	if vars == nil {
 		return fmt.Errorf("Missing parameter")
@@ -762,6 +878,104 @@ func postContainersAttach(srv *Server, version float64, w http.ResponseWriter, r
 	return nil
 }
 
+func postContainersExec(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	name := vars["name"]
+	config := &ExecConfig{}
+	if err := json.NewDecoder(r.Body).Decode(config); err != nil {
+		return err
+	}
+	id, err := srv.ContainerExecCreate(name, config)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&APIID{ID: id})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, b)
+	return nil
+}
+
+func postExecStart(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	stdin, err := getBoolParam(r.Form.Get("stdin"))
+	if err != nil {
+		return err
+	}
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	name := vars["name"]
+	if srv.runtime.GetExec(name) == nil {
+		return fmt.Errorf("No such exec: %s", name)
+	}
+
+	in, out, err := hijackServer(w)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tcpc, ok := in.(*net.TCPConn); ok {
+			tcpc.CloseWrite()
+		} else {
+			in.Close()
+		}
+	}()
+	defer func() {
+		if tcpc, ok := out.(*net.TCPConn); ok {
+			tcpc.CloseWrite()
+		} else if closer, ok := out.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+
+	fmt.Fprintf(out, "HTTP/1.1 200 OK\r\nContent-Type: application/vnd.docker.raw-stream\r\n\r\n")
+	if err := srv.ContainerExecStart(name, stdin, in, out); err != nil {
+		fmt.Fprintf(out, "Error: %s\n", err)
+	}
+	return nil
+}
+
+func postExecWait(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	status, err := srv.ContainerExecWait(vars["name"])
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&APIWait{StatusCode: status})
+	if err != nil {
+		return err
+	}
+	writeJSON(w, b)
+	return nil
+}
+
+func postExecResize(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	height, err := strconv.Atoi(r.Form.Get("h"))
+	if err != nil {
+		return err
+	}
+	width, err := strconv.Atoi(r.Form.Get("w"))
+	if err != nil {
+		return err
+	}
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	return srv.ContainerExecResize(vars["name"], height, width)
+}
+
 func wsContainersAttach(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 
 	if err := parseForm(r); err != nil {
@@ -1033,6 +1247,7 @@ func createRouter(srv *Server, logging bool) (*mux.Router, error) {
 			"/containers/{name:.*}/changes":   getContainersChanges,
 			"/containers/{name:.*}/json":      getContainersByName,
 			"/containers/{name:.*}/top":       getContainersTop,
+			"/containers/{name:.*}/stats":     getContainersStats,
 			"/containers/{name:.*}/attach/ws": wsContainersAttach,
 		},
 		"POST": {
@@ -1046,13 +1261,20 @@ func createRouter(srv *Server, logging bool) (*mux.Router, error) {
 			"/images/getCache":              postImagesGetCache,
 			"/containers/create":            postContainersCreate,
 			"/containers/{name:.*}/kill":    postContainersKill,
+			"/containers/{name:.*}/pause":   postContainersPause,
+			"/containers/{name:.*}/unpause": postContainersUnpause,
 			"/containers/{name:.*}/restart": postContainersRestart,
+			"/containers/{name:.*}/rename":  postContainersRename,
 			"/containers/{name:.*}/start":   postContainersStart,
 			"/containers/{name:.*}/stop":    postContainersStop,
 			"/containers/{name:.*}/wait":    postContainersWait,
 			"/containers/{name:.*}/resize":  postContainersResize,
 			"/containers/{name:.*}/attach":  postContainersAttach,
 			"/containers/{name:.*}/copy":    postContainersCopy,
+			"/containers/{name:.*}/exec":    postContainersExec,
+			"/exec/{name:.*}/start":         postExecStart,
+			"/exec/{name:.*}/wait":          postExecWait,
+			"/exec/{name:.*}/resize":        postExecResize,
 		},
 		"DELETE": {
 			"/containers/{name:.*}": deleteContainers,
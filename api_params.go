@@ -1,5 +1,7 @@
 package docker
 
+import "time"
+
 type APIHistory struct {
 	ID        string   `json:"Id"`
 	Tags      []string `json:",omitempty"`
@@ -14,6 +16,7 @@ type APIImages struct {
 	Created     int64
 	Size        int64
 	VirtualSize int64
+	Labels      map[string]string `json:",omitempty"`
 }
 
 type APIInfo struct {
@@ -26,6 +29,8 @@ type APIInfo struct {
 	SwapLimit          bool   `json:",omitempty"`
 	IPv4Forwarding     bool   `json:",omitempty"`
 	LXCVersion         string `json:",omitempty"`
+	ExecutionDriver    string `json:",omitempty"`
+	StorageDriver      string `json:",omitempty"`
 	NEventsListener    int    `json:",omitempty"`
 	KernelVersion      string `json:",omitempty"`
 	IndexServerAddress string `json:",omitempty"`
@@ -43,6 +48,7 @@ type APIRmi struct {
 
 type APIContainers struct {
 	ID         string `json:"Id"`
+	Name       string `json:",omitempty"`
 	Image      string
 	Command    string
 	Created    int64
@@ -50,6 +56,7 @@ type APIContainers struct {
 	Ports      string
 	SizeRw     int64
 	SizeRootFs int64
+	Labels     map[string]string `json:",omitempty"`
 }
 
 type APISearch struct {
@@ -93,3 +100,17 @@ type APICopy struct {
 	Resource string
 	HostPath string
 }
+
+type APIStats struct {
+	Read          time.Time
+	CPUUsage      uint64 // in nanoseconds
+	MemoryUsage   uint64
+	MemoryLimit   uint64
+	MemoryFailcnt uint64
+	BlkioRead     uint64
+	BlkioWrite    uint64
+	RxBytes       uint64
+	RxPackets     uint64
+	TxBytes       uint64
+	TxPackets     uint64
+}
@@ -12,6 +12,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -120,7 +121,7 @@ func TestGetEvents(t *testing.T) {
 		} else if err != nil {
 			t.Fatal(err)
 		}
-		if jm != srv.events[i] {
+		if !reflect.DeepEqual(jm, srv.events[i]) {
 			t.Fatalf("Event received it different than expected")
 		}
 	}
@@ -135,7 +136,7 @@ func TestGetImagesJSON(t *testing.T) {
 
 	// all=0
 
-	initialImages, err := srv.Images(false, "")
+	initialImages, err := srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -175,7 +176,7 @@ func TestGetImagesJSON(t *testing.T) {
 
 	// all=1
 
-	initialImages, err = srv.Images(true, "")
+	initialImages, err = srv.Images(true, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -324,7 +325,7 @@ func TestGetContainersJSON(t *testing.T) {
 	container, err := NewBuilder(runtime).Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"echo", "test"},
-	})
+	}, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -352,6 +353,9 @@ func TestGetContainersJSON(t *testing.T) {
 }
 
 func TestGetContainersExport(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -364,7 +368,7 @@ func TestGetContainersExport(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"touch", "/test"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -404,6 +408,9 @@ func TestGetContainersExport(t *testing.T) {
 }
 
 func TestGetContainersChanges(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -416,7 +423,7 @@ func TestGetContainersChanges(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"/bin/rm", "/etc/passwd"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -448,6 +455,61 @@ func TestGetContainersChanges(t *testing.T) {
 	}
 }
 
+func TestGetContainersStats(t *testing.T) {
+	runtime, err := newTestRuntime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nuke(runtime)
+
+	srv := &Server{runtime: runtime}
+
+	container, err := NewBuilder(runtime).Create(
+		&Config{
+			Image:     GetTestImage(runtime).ID,
+			Cmd:       []string{"cat"},
+			OpenStdin: true,
+		}, "",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container)
+
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/containers/"+container.ID+"/stats?stream=0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getContainersStats(srv, APIVERSION, r, req, map[string]string{"name": container.ID}); err == nil {
+		t.Fatalf("Getting the stats of a stopped container should fail")
+	}
+
+	defer func() {
+		// Make sure the process dies before destroying runtime
+		container.stdin.Close()
+		container.WaitTimeout(2 * time.Second)
+	}()
+	if err := container.Start(&HostConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	r = httptest.NewRecorder()
+	if err := getContainersStats(srv, APIVERSION, r, req, map[string]string{"name": container.ID}); err != nil {
+		t.Fatal(err)
+	}
+	stats := &APIStats{}
+	if err := json.Unmarshal(r.Body.Bytes(), stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read.IsZero() {
+		t.Fatalf("The sample should have a timestamp")
+	}
+	if _, err := utils.FindCgroupMountpoint("memory"); err == nil && (stats.MemoryUsage == 0 || stats.MemoryLimit == 0) {
+		t.Fatalf("Expected the memory usage and limit to be reported, found %d and %d", stats.MemoryUsage, stats.MemoryLimit)
+	}
+}
+
 func TestGetContainersTop(t *testing.T) {
 	runtime, err := newTestRuntime()
 	if err != nil {
@@ -464,7 +526,7 @@ func TestGetContainersTop(t *testing.T) {
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"/bin/sh", "-c", "cat"},
 			OpenStdin: true,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -547,7 +609,7 @@ func TestGetContainersByName(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"echo", "test"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -580,7 +642,7 @@ func TestPostCommit(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"touch", "/test"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -614,6 +676,9 @@ func TestPostCommit(t *testing.T) {
 }
 
 func TestPostContainersCreate(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -675,7 +740,7 @@ func TestPostContainersKill(t *testing.T) {
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"/bin/cat"},
 			OpenStdin: true,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -695,7 +760,11 @@ func TestPostContainersKill(t *testing.T) {
 	}
 
 	r := httptest.NewRecorder()
-	if err := postContainersKill(srv, APIVERSION, r, nil, map[string]string{"name": container.ID}); err != nil {
+	req, err := http.NewRequest("POST", "/containers/"+container.ID+"/kill", bytes.NewReader([]byte{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := postContainersKill(srv, APIVERSION, r, req, map[string]string{"name": container.ID}); err != nil {
 		t.Fatal(err)
 	}
 	if r.Code != http.StatusNoContent {
@@ -717,7 +786,7 @@ func TestPostContainersRestart(t *testing.T) {
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"/bin/cat"},
 			OpenStdin: true,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -771,7 +840,7 @@ func TestPostContainersStart(t *testing.T) {
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"/bin/cat"},
 			OpenStdin: true,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -821,7 +890,7 @@ func TestPostContainersStop(t *testing.T) {
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"/bin/cat"},
 			OpenStdin: true,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -868,7 +937,7 @@ func TestPostContainersWait(t *testing.T) {
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"/bin/sleep", "1"},
 			OpenStdin: true,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -910,7 +979,7 @@ func TestPostContainersAttach(t *testing.T) {
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"/bin/cat"},
 			OpenStdin: true,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1000,7 +1069,7 @@ func TestDeleteContainers(t *testing.T) {
 	container, err := NewBuilder(runtime).Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"touch", "/test"},
-	})
+	}, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1098,7 +1167,7 @@ func TestDeleteImages(t *testing.T) {
 
 	srv := &Server{runtime: runtime}
 
-	initialImages, err := srv.Images(false, "")
+	initialImages, err := srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1107,7 +1176,7 @@ func TestDeleteImages(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	images, err := srv.Images(false, "")
+	images, err := srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1146,7 +1215,7 @@ func TestDeleteImages(t *testing.T) {
 	if len(outs) != 1 {
 		t.Fatalf("Expected %d event (untagged), got %d", 1, len(outs))
 	}
-	images, err = srv.Images(false, "")
+	images, err = srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1179,6 +1248,9 @@ func TestJsonContentType(t *testing.T) {
 }
 
 func TestPostContainersCopy(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -1191,7 +1263,7 @@ func TestPostContainersCopy(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"touch", "/test.txt"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
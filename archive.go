@@ -1,16 +1,23 @@
 package docker
 
 import (
-	"archive/tar"
+	"bufio"
 	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"fmt"
 	"github.com/dotcloud/docker/utils"
+	"github.com/dotcloud/tar"
+	"github.com/ulikunitz/xz"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type Archive io.Reader
@@ -85,15 +92,170 @@ func Tar(path string, compression Compression) (io.Reader, error) {
 
 // Tar creates an archive from the directory at `path`, only including files whose relative
 // paths are included in `filter`. If `filter` is nil, then all files are included.
+// Ownership is stored numerically, and hardlinks, devices and extended
+// attributes are preserved.
 func TarFilter(path string, compression Compression, filter []string) (io.Reader, error) {
-	args := []string{"tar", "--numeric-owner", "-f", "-", "-C", path}
 	if filter == nil {
 		filter = []string{"."}
 	}
-	for _, f := range filter {
-		args = append(args, "-c"+compression.Flag(), f)
+	pipeR, pipeW := io.Pipe()
+	go func() {
+		// Buffering also spares readers the empty writes of tar.Writer
+		buf := bufio.NewWriter(pipeW)
+		tw := tar.NewWriter(buf)
+		inodes := make(map[uint64]string)
+		for _, include := range filter {
+			if err := addTarTree(tw, path, include, inodes); err != nil {
+				pipeW.CloseWithError(err)
+				return
+			}
+		}
+		if err := tw.Close(); err != nil {
+			pipeW.CloseWithError(err)
+			return
+		}
+		pipeW.CloseWithError(buf.Flush())
+	}()
+	return compressStream(pipeR, compression)
+}
+
+// compressStream returns the stream src compressed with compression.
+func compressStream(src io.Reader, compression Compression) (io.Reader, error) {
+	var newWriter func(io.Writer) (io.WriteCloser, error)
+	switch compression {
+	case Uncompressed:
+		return src, nil
+	case Bzip2:
+		// The standard library can only decompress bzip2
+		cmd := exec.Command("bzip2", "-c")
+		cmd.Stdin = src
+		return CmdStream(cmd)
+	case Gzip:
+		newWriter = func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		}
+	case Xz:
+		newWriter = func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported compression format %s", compression.Extension())
+	}
+	pipeR, pipeW := io.Pipe()
+	buf := bufio.NewWriter(pipeW)
+	w, err := newWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if _, err := io.Copy(w, src); err != nil {
+			pipeW.CloseWithError(err)
+			return
+		}
+		if err := w.Close(); err != nil {
+			pipeW.CloseWithError(err)
+			return
+		}
+		pipeW.CloseWithError(buf.Flush())
+	}()
+	return pipeR, nil
+}
+
+// decompressStream returns the stream src decompressed with compression.
+func decompressStream(src io.Reader, compression Compression) (io.Reader, error) {
+	switch compression {
+	case Uncompressed:
+		return src, nil
+	case Bzip2:
+		return bzip2.NewReader(src), nil
+	case Gzip:
+		return gzip.NewReader(src)
+	case Xz:
+		return xz.NewReader(src)
+	}
+	return nil, fmt.Errorf("Unsupported compression format %s", compression.Extension())
+}
+
+// addTarTree adds the file or directory tree include, relative to root, to
+// the archive. inodes maps the files with several links already added to
+// their name in the archive.
+func addTarTree(tw *tar.Writer, root, include string, inodes map[uint64]string) error {
+	return filepath.Walk(filepath.Join(root, include), func(pth string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, pth)
+		if err != nil {
+			return err
+		}
+		// Skip the AUFS metadata of read-write layers
+		if filepath.Dir(name) == "." && isWhiteoutMeta(name) {
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return addTarFile(tw, pth, name, f, inodes)
+	})
+}
+
+func addTarFile(tw *tar.Writer, pth, name string, f os.FileInfo, inodes map[uint64]string) error {
+	if f.Mode()&os.ModeSocket != 0 {
+		utils.Debugf("Skipping socket %s", pth)
+		return nil
+	}
+	var link string
+	if f.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(pth); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(f, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if f.IsDir() {
+		hdr.Name += "/"
 	}
-	return CmdStream(exec.Command(args[0], args[1:]...))
+	// Only store what tar stores by default, with the owners by number
+	hdr.Uname = ""
+	hdr.Gname = ""
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if ok {
+		setHeaderFromStat(hdr, stat)
+		if hdr.Typeflag == tar.TypeReg && stat.Nlink > 1 {
+			if first, exists := inodes[uint64(stat.Ino)]; exists {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+			} else {
+				inodes[uint64(stat.Ino)] = name
+			}
+		}
+	}
+	if hdr.Typeflag != tar.TypeSymlink {
+		if hdr.Xattrs, err = getXattrs(pth); err != nil {
+			return err
+		}
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		file, err := os.Open(pth)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if _, err := io.Copy(tw, file); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Untar reads a stream of bytes from `archive`, parses it as a tar archive,
@@ -123,18 +285,190 @@ func Untar(archive io.Reader, path string) error {
 
 	utils.Debugf("Archive compression detected: %s", compression.Extension())
 
-	cmd := exec.Command("tar", "--numeric-owner", "-f", "-", "-C", path, "-x"+compression.Flag())
-	cmd.Stdin = io.MultiReader(bytes.NewReader(buf), archive)
-	// Hardcode locale environment for predictable outcome regardless of host configuration.
-	//   (see https://github.com/dotcloud/docker/issues/355)
-	cmd.Env = []string{"LANG=en_US.utf-8", "LC_ALL=en_US.utf-8"}
-	output, err := cmd.CombinedOutput()
+	decompressed, err := decompressStream(io.MultiReader(bytes.NewReader(buf), archive), compression)
 	if err != nil {
-		return fmt.Errorf("%s: %s", err, output)
+		return err
+	}
+	tr := tar.NewReader(decompressed)
+	// Directories are created before their content, which changes their
+	// mtime: restore it last
+	var dirs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// Paths are relative to the destination, even absolute ones, and
+		// can't escape it
+		target := filepath.Join(path, filepath.Clean("/"+hdr.Name))
+		if err := createTarFile(target, path, hdr, tr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, hdr)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target := filepath.Join(path, filepath.Clean("/"+dirs[i].Name))
+		// A later entry may have replaced the directory by a symlink
+		if f, err := os.Lstat(target); err != nil || !f.IsDir() {
+			continue
+		}
+		if err := os.Chtimes(target, dirs[i].ModTime, dirs[i].ModTime); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// createTarFile creates target, within the directory root, from hdr and
+// the content of the current entry of tr.
+func createTarFile(target, root string, hdr *tar.Header, tr *tar.Reader) error {
+	// An earlier entry could have made a parent a symlink to anywhere
+	if err := checkParents(root, target); err != nil {
+		return err
+	}
+	// Replace whatever is in the way, except directories being extracted
+	// again
+	if f, err := os.Lstat(target); err == nil {
+		if !f.IsDir() || hdr.Typeflag != tar.TypeDir {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	mode := hdr.FileInfo().Mode()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(target, mode.Perm()); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, mode.Perm())
+		if err != nil {
+			return err
+		}
+		if err := copySparse(file, tr, hdr.Size); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		source := filepath.Join(root, filepath.Clean("/"+hdr.Linkname))
+		if err := checkParents(root, source); err != nil {
+			return err
+		}
+		return os.Link(source, target)
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		var fileType uint32
+		switch hdr.Typeflag {
+		case tar.TypeChar:
+			fileType = syscall.S_IFCHR
+		case tar.TypeBlock:
+			fileType = syscall.S_IFBLK
+		default:
+			fileType = syscall.S_IFIFO
+		}
+		if err := syscall.Mknod(target, fileType|uint32(mode.Perm()), mkdev(hdr.Devmajor, hdr.Devminor)); err != nil {
+			return fmt.Errorf("Unable to create %s: %s", target, err)
+		}
+	case tar.TypeXGlobalHeader:
+		utils.Debugf("PAX Global Extended Headers found and ignored")
+		return nil
+	default:
+		return fmt.Errorf("Unhandled tar header type %d for %s", hdr.Typeflag, hdr.Name)
+	}
+
+	if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		// Neither the permissions nor the times of symlinks can be set
+		return nil
+	}
+	for key, value := range hdr.Xattrs {
+		// Like the owner, they are dropped where they can't be set: the
+		// filesystem may not support them, and only root may set the ones
+		// of the trusted and security namespaces
+		if err := setXattr(target, key, value); err != nil && err != syscall.ENOTSUP && err != syscall.EPERM {
+			return err
+		}
+	}
+	// Chmod after chown, which clears the setuid bits
+	if err := os.Chmod(target, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
+
+// checkParents returns an error if one of the parents of target below root
+// is a symlink, through which target could be outside of root.
+func checkParents(root, target string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+	parent := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		parent = filepath.Join(parent, name)
+		f, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			// MkdirAll creates the rest
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Impossible to extract %s: %s is a symlink", strings.TrimPrefix(target, root), strings.TrimPrefix(parent, root))
+		}
+	}
+	return nil
+}
+
+// copySparse writes size bytes of src to the new file dst, leaving holes
+// where blocks are zeroed, so that sparse files stay sparse.
+func copySparse(dst *os.File, src io.Reader, size int64) error {
+	buf := make([]byte, 4096)
+	zero := make([]byte, len(buf))
+	for written := int64(0); written < size; {
+		n, err := io.ReadFull(src, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if n == len(buf) && bytes.Equal(buf, zero) {
+			if _, err := dst.Seek(int64(n), os.SEEK_CUR); err != nil {
+				return err
+			}
+		} else if _, err := dst.Write(buf[:n]); err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+	// The file ends with a hole when the last block was zeroed
+	return dst.Truncate(size)
+}
+
 // TarUntar is a convenience function which calls Tar and Untar, with
 // the output of one piped into the other. If either Tar or Untar fails,
 // TarUntar aborts and returns the error.
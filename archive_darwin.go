@@ -0,0 +1,27 @@
+package docker
+
+import (
+	"github.com/dotcloud/tar"
+	"syscall"
+)
+
+func setHeaderFromStat(hdr *tar.Header, stat *syscall.Stat_t) {
+	hdr.Uid = int(stat.Uid)
+	hdr.Gid = int(stat.Gid)
+	if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock {
+		hdr.Devmajor = int64((stat.Rdev >> 24) & 0xff)
+		hdr.Devminor = int64(stat.Rdev & 0xffffff)
+	}
+}
+
+func mkdev(major, minor int64) int {
+	return int((major << 24) | minor)
+}
+
+func getXattrs(path string) (map[string]string, error) {
+	return nil, nil
+}
+
+func setXattr(path, key, value string) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"bytes"
+	"github.com/dotcloud/tar"
+	"syscall"
+)
+
+// setHeaderFromStat fills in the numeric owners and the device numbers of
+// hdr from stat.
+func setHeaderFromStat(hdr *tar.Header, stat *syscall.Stat_t) {
+	hdr.Uid = int(stat.Uid)
+	hdr.Gid = int(stat.Gid)
+	if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock {
+		rdev := uint64(stat.Rdev)
+		hdr.Devmajor = int64((rdev >> 8) & 0xfff)
+		hdr.Devminor = int64((rdev & 0xff) | ((rdev >> 12) & 0xfff00))
+	}
+}
+
+func mkdev(major, minor int64) int {
+	return int(((major & 0xfff) << 8) | (minor & 0xff) | ((minor & 0xfff00) << 12))
+}
+
+// getXattrs returns the extended attributes of the file at path, which must
+// not be a symlink.
+func getXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err == syscall.ENOTSUP || size == 0 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+	xattrs := make(map[string]string)
+	for _, key := range bytes.Split(buf[:size], []byte{0}) {
+		if len(key) == 0 {
+			continue
+		}
+		size, err := syscall.Getxattr(path, string(key), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		if size, err = syscall.Getxattr(path, string(key), value); err != nil {
+			return nil, err
+		}
+		xattrs[string(key)] = string(value[:size])
+	}
+	return xattrs, nil
+}
+
+func setXattr(path, key, value string) error {
+	return syscall.Setxattr(path, key, []byte(value), 0)
+}
@@ -3,11 +3,13 @@ package docker
 import (
 	"bytes"
 	"fmt"
+	"github.com/dotcloud/tar"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -116,3 +118,186 @@ func TestTarUntar(t *testing.T) {
 		}
 	}
 }
+
+func TestTarUntarMetadata(t *testing.T) {
+	origin, err := ioutil.TempDir("", "docker-test-untar-origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(origin)
+	if err := ioutil.WriteFile(path.Join(origin, "file"), []byte("hello world"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path.Join(origin, "file"), 04755); err != nil {
+		t.Fatal(err)
+	}
+	// Some filesystems drop the setuid bit
+	origFile, err := os.Stat(path.Join(origin, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path.Join(origin, "file"), path.Join(origin, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", path.Join(origin, "symlink")); err != nil {
+		t.Fatal(err)
+	}
+	// Not every filesystem and platform has extended attributes
+	xattrs := false
+	if setXattr(path.Join(origin, "file"), "user.docker", "test") == nil {
+		values, _ := getXattrs(path.Join(origin, "file"))
+		xattrs = values["user.docker"] == "test"
+	}
+	// Only root can create devices
+	devices := syscall.Mknod(path.Join(origin, "null"), syscall.S_IFCHR|0666, mkdev(1, 3)) == nil
+	sparse, err := os.Create(path.Join(origin, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sparse.WriteAt([]byte("end"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	sparse.Close()
+
+	archive, err := Tar(origin, Uncompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempDir("", "docker-test-untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := Untar(archive, tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Stat(path.Join(tmp, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Mode() != origFile.Mode() {
+		t.Errorf("Expected mode %s, found %s", origFile.Mode(), file.Mode())
+	}
+	if link, err := os.Stat(path.Join(tmp, "link")); err != nil {
+		t.Fatal(err)
+	} else if !os.SameFile(file, link) {
+		t.Errorf("link should be a hardlink to file")
+	}
+	if target, err := os.Readlink(path.Join(tmp, "symlink")); err != nil {
+		t.Fatal(err)
+	} else if target != "file" {
+		t.Errorf("Expected symlink to point to file, found %s", target)
+	}
+	if xattrs {
+		if values, err := getXattrs(path.Join(tmp, "file")); err != nil {
+			t.Fatal(err)
+		} else if values["user.docker"] != "test" {
+			t.Errorf("Expected the user.docker attribute to be test, found %s", values["user.docker"])
+		}
+	}
+	if devices {
+		if st, err := os.Stat(path.Join(tmp, "null")); err != nil {
+			t.Fatal(err)
+		} else if rdev := st.Sys().(*syscall.Stat_t).Rdev; st.Mode()&os.ModeCharDevice == 0 || int(rdev) != mkdev(1, 3) {
+			t.Errorf("Expected null to be the character device 1:3, found %s %d", st.Mode(), rdev)
+		}
+	}
+	if st, err := os.Stat(path.Join(tmp, "sparse")); err != nil {
+		t.Fatal(err)
+	} else if st.Size() != 1<<20+3 {
+		t.Errorf("Expected a size of %d, found %d", 1<<20+3, st.Size())
+	} else if blocks := st.Sys().(*syscall.Stat_t).Blocks; blocks*512 >= st.Size() {
+		t.Errorf("sparse should have stayed sparse, it uses %d blocks", blocks)
+	}
+}
+
+// Extended attributes which can't be set don't prevent the extraction
+func TestUntarUnsupportedXattrs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	hdr := &tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: 5, Xattrs: map[string]string{
+		// Unknown to Linux
+		"docker.test": "test",
+		// Only root may set it
+		"trusted.docker": "test",
+	}}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tmp, err := ioutil.TempDir("", "docker-test-untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := Untar(buf, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(path.Join(tmp, "file")); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "hello" {
+		t.Errorf("Expected hello, found %s", data)
+	}
+}
+
+// Entries can't be written through the symlinks of earlier entries, which
+// could point anywhere on the host
+func TestUntarSymlinkEscape(t *testing.T) {
+	outside, err := ioutil.TempDir("", "docker-test-untar-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(path.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, headers := range [][]*tar.Header{
+		{
+			{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0777},
+			{Name: "a/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		},
+		{
+			{Name: "b", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0777},
+			{Name: "c", Typeflag: tar.TypeLink, Linkname: "b/secret", Mode: 0600},
+		},
+	} {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, hdr := range headers {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Size > 0 {
+				if _, err := tw.Write([]byte("evil")); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		tmp, err := ioutil.TempDir("", "docker-test-untar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		if err := Untar(buf, tmp); err == nil {
+			t.Errorf("Expected extracting %s to fail", headers[1].Name)
+		}
+		if _, err := os.Lstat(path.Join(outside, "passwd")); err == nil {
+			t.Fatalf("The archive wrote outside of the destination")
+		}
+		if _, err := os.Lstat(path.Join(tmp, "c")); err == nil {
+			t.Fatalf("The archive linked to a file outside of the destination")
+		}
+	}
+}
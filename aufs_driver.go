@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	registerGraphDriver("aufs", func() (GraphDriver, error) {
+		return &aufsDriver{}, nil
+	})
+}
+
+// aufsDriver mounts the layers with AUFS, which format is the one of the
+// archives: layers are stored as they are unpacked.
+type aufsDriver struct {
+}
+
+func (d *aufsDriver) Name() string {
+	return "aufs"
+}
+
+func (d *aufsDriver) Create(layer string, data Archive) error {
+	return untarLayer(layer, data)
+}
+
+func (d *aufsDriver) Mount(layers []string, rw, target string) error {
+	return MountAUFS(layers, rw, target)
+}
+
+func (d *aufsDriver) Unmount(layers []string, rw, target string) error {
+	return Unmount(target)
+}
+
+func (d *aufsDriver) Mounted(target string) (bool, error) {
+	return Mounted(target)
+}
+
+func (d *aufsDriver) Diff(layers []string, rw, target string) (Archive, error) {
+	return Tar(rw, Uncompressed)
+}
+
+func (d *aufsDriver) Changes(layers []string, rw, target string) ([]Change, error) {
+	return Changes(layers, rw)
+}
+
+func (d *aufsDriver) Size(layers []string, rw, target string) (int64, error) {
+	return dirSize(rw)
+}
+
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if fileInfo != nil {
+			size += fileInfo.Size()
+		}
+		return nil
+	})
+	return size, err
+}
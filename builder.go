@@ -2,9 +2,7 @@ package docker
 
 import (
 	"fmt"
-	"github.com/dotcloud/docker/utils"
 	"os"
-	"path"
 	"time"
 )
 
@@ -27,7 +25,15 @@ func NewBuilder(runtime *Runtime) *Builder {
 	}
 }
 
-func (builder *Builder) Create(config *Config) (*Container, error) {
+// Create creates a new container from config. name may be empty, in which
+// case the container can only be referred to by its id.
+func (builder *Builder) Create(config *Config, name string) (*Container, error) {
+	if name != "" {
+		if err := builder.runtime.checkName(name); err != nil {
+			return nil, err
+		}
+	}
+
 	// Lookup image
 	img, err := builder.repositories.LookupImage(config.Image)
 	if err != nil {
@@ -66,6 +72,7 @@ func (builder *Builder) Create(config *Config) (*Container, error) {
 	container := &Container{
 		// FIXME: we should generate the ID here instead of receiving it as an argument
 		ID:              id,
+		Name:            name,
 		Created:         time.Now(),
 		Path:            entrypoint,
 		Args:            args, //FIXME: de-duplicate from config
@@ -82,45 +89,14 @@ func (builder *Builder) Create(config *Config) (*Container, error) {
 		return nil, err
 	}
 
-	resolvConf, err := utils.GetResolvConf()
-	if err != nil {
-		return nil, err
-	}
-
-	if len(config.Dns) == 0 && len(builder.runtime.Dns) == 0 && utils.CheckLocalDns(resolvConf) {
-		//"WARNING: Docker detected local DNS server on resolv.conf. Using default external servers: %v", defaultDns
-		builder.runtime.Dns = defaultDns
-	}
-
-	// If custom dns exists, then create a resolv.conf for the container
-	if len(config.Dns) > 0 || len(builder.runtime.Dns) > 0 {
-		var dns []string
-		if len(config.Dns) > 0 {
-			dns = config.Dns
-		} else {
-			dns = builder.runtime.Dns
-		}
-		container.ResolvConfPath = path.Join(container.root, "resolv.conf")
-		f, err := os.Create(container.ResolvConfPath)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		for _, dns := range dns {
-			if _, err := f.Write([]byte("nameserver " + dns + "\n")); err != nil {
-				return nil, err
-			}
-		}
-	} else {
-		container.ResolvConfPath = "/etc/resolv.conf"
-	}
-
 	// Step 2: save the container json
 	if err := container.ToDisk(); err != nil {
 		return nil, err
 	}
 	// Step 3: register the container
 	if err := builder.runtime.Register(container); err != nil {
+		// e.g. another container took the name in the meantime
+		os.RemoveAll(container.root)
 		return nil, err
 	}
 	return container, nil
@@ -129,7 +105,6 @@ func (builder *Builder) Create(config *Config) (*Container, error) {
 // Commit creates a new filesystem image from the current state of a container.
 // The image can optionally be tagged into a repository
 func (builder *Builder) Commit(container *Container, repository, tag, comment, author string, config *Config) (*Image, error) {
-	// FIXME: freeze the container before copying it to avoid data corruption?
 	// FIXME: this shouldn't be in commands.
 	if err := container.EnsureMounted(); err != nil {
 		return nil, err
@@ -12,6 +12,7 @@ import (
 	"path"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -202,6 +203,56 @@ func (b *buildFile) CmdUser(args string) error {
 	return b.commit("", b.config.Cmd, fmt.Sprintf("USER %v", args))
 }
 
+// CmdHealthcheck sets the command run to check the health of the containers
+// of the image: HEALTHCHECK [-interval=N] [-timeout=N] [-retries=N] CMD command,
+// with durations in seconds, or HEALTHCHECK NONE to disable the one of the
+// base image.
+func (b *buildFile) CmdHealthcheck(args string) error {
+	args = strings.TrimSpace(args)
+	if strings.ToUpper(args) == "NONE" {
+		b.config.Healthcheck = &HealthConfig{Test: []string{"NONE"}}
+		return b.commit("", b.config.Cmd, "HEALTHCHECK NONE")
+	}
+
+	healthcheck := &HealthConfig{}
+	rest := args
+	for strings.HasPrefix(rest, "-") {
+		parts := strings.SplitN(rest, " ", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("HEALTHCHECK requires a command")
+		}
+		option := strings.SplitN(strings.TrimLeft(parts[0], "-"), "=", 2)
+		if len(option) != 2 {
+			return fmt.Errorf("Invalid HEALTHCHECK option: %s", parts[0])
+		}
+		value, err := strconv.Atoi(option[1])
+		if err != nil || value < 0 {
+			return fmt.Errorf("Invalid HEALTHCHECK option: %s", parts[0])
+		}
+		switch option[0] {
+		case "interval":
+			healthcheck.Interval = value
+		case "timeout":
+			healthcheck.Timeout = value
+		case "retries":
+			healthcheck.Retries = value
+		default:
+			return fmt.Errorf("Unknown HEALTHCHECK option: %s", parts[0])
+		}
+		rest = strings.TrimSpace(parts[1])
+	}
+
+	parts := strings.SplitN(rest, " ", 2)
+	if len(parts) != 2 || strings.ToUpper(parts[0]) != "CMD" {
+		return fmt.Errorf("Invalid HEALTHCHECK: expected [OPTIONS] CMD command, or NONE")
+	}
+	if err := json.Unmarshal([]byte(parts[1]), &healthcheck.Test); err != nil {
+		healthcheck.Test = []string{"/bin/sh", "-c", parts[1]}
+	}
+	b.config.Healthcheck = healthcheck
+	return b.commit("", b.config.Cmd, fmt.Sprintf("HEALTHCHECK %s", args))
+}
+
 func (b *buildFile) CmdInsert(args string) error {
 	return fmt.Errorf("INSERT has been deprecated. Please use ADD instead")
 }
@@ -227,6 +278,76 @@ func (b *buildFile) CmdEntrypoint(args string) error {
 	return nil
 }
 
+// CmdStopsignal sets the signal docker stop sends to the containers of the
+// image: STOPSIGNAL signal, by name or number.
+func (b *buildFile) CmdStopsignal(args string) error {
+	args = strings.TrimSpace(args)
+	if _, err := parseSignal(args); err != nil {
+		return err
+	}
+	b.config.StopSignal = args
+	return b.commit("", b.config.Cmd, fmt.Sprintf("STOPSIGNAL %s", args))
+}
+
+// CmdLabel adds labels to the image: LABEL key=value [key="value"...].
+// Values with spaces must be quoted.
+func (b *buildFile) CmdLabel(args string) error {
+	words, err := splitQuoted(args)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("LABEL requires at least one key=value")
+	}
+	labels, err := parseLabels(words)
+	if err != nil {
+		return err
+	}
+	// The map may still be the one of the base image
+	merged := make(map[string]string)
+	for key, value := range b.config.Labels {
+		merged[key] = value
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	b.config.Labels = merged
+	return b.commit("", b.config.Cmd, fmt.Sprintf("LABEL %s", strings.TrimSpace(args)))
+}
+
+// splitQuoted splits args on whitespace, except within double quotes,
+// which are removed.
+func splitQuoted(args string) ([]string, error) {
+	var (
+		words   []string
+		word    []rune
+		inWord  bool
+		inQuote bool
+	)
+	for _, r := range args {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inWord = true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+		default:
+			word = append(word, r)
+			inWord = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("Unterminated quote in %s", args)
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
 func (b *buildFile) CmdWorkdir(workdir string) error {
 	b.config.WorkingDir = workdir
 	return b.commit("", b.config.Cmd, fmt.Sprintf("WORKDIR %v", workdir))
@@ -337,7 +458,7 @@ func (b *buildFile) CmdAdd(args string) error {
 
 	b.config.Image = b.image
 	// Create the container and start it
-	container, err := b.builder.Create(b.config)
+	container, err := b.builder.Create(b.config, "")
 	if err != nil {
 		return err
 	}
@@ -372,7 +493,7 @@ func (b *buildFile) run() (string, error) {
 	b.config.Image = b.image
 
 	// Create the container and start it
-	c, err := b.builder.Create(b.config)
+	c, err := b.builder.Create(b.config, "")
 	if err != nil {
 		return "", err
 	}
@@ -383,6 +504,13 @@ func (b *buildFile) run() (string, error) {
 	c.Path = b.config.Cmd[0]
 	c.Args = b.config.Cmd[1:]
 
+	// The health check is for the containers of the image, not this one
+	if c.Config.Healthcheck != nil {
+		config := *c.Config
+		config.Healthcheck = nil
+		c.Config = &config
+	}
+
 	//start the container
 	hostConfig := &HostConfig{}
 	if err := c.Start(hostConfig); err != nil {
@@ -428,7 +556,7 @@ func (b *buildFile) commit(id string, autoCmd []string, comment string) error {
 			}
 		}
 
-		container, err := b.builder.Create(b.config)
+		container, err := b.builder.Create(b.config, "")
 		if err != nil {
 			return err
 		}
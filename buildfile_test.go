@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -194,6 +195,9 @@ func mkTestingFileServer(files [][2]string) (*httptest.Server, error) {
 }
 
 func TestBuild(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	for _, ctx := range testContexts {
 		buildImage(ctx, t, nil, true)
 	}
@@ -226,7 +230,10 @@ func buildImage(context testContextTemplate, t *testing.T, srv *Server, useCache
 	}
 	port := httpServer.URL[idx+1:]
 
-	ip := srv.runtime.networkManager.bridgeNetwork.IP
+	ip := net.ParseIP("127.0.0.1")
+	if !srv.runtime.networkManager.disabled {
+		ip = srv.runtime.networkManager.bridgeNetwork.IP
+	}
 	dockerfile := constructDockerfile(context.dockerfile, ip, port)
 
 	buildfile := NewBuildFile(srv, ioutil.Discard, false, useCache)
@@ -339,6 +346,36 @@ func TestBuildEntrypoint(t *testing.T) {
 	}
 }
 
+func TestBuildHealthcheck(t *testing.T) {
+	img := buildImage(testContextTemplate{`
+        from {IMAGE}
+        healthcheck -interval=5 -retries=2 CMD ["cat", "/etc/hosts"]
+        `,
+		nil, nil}, t, nil, true)
+
+	healthcheck := img.Config.Healthcheck
+	if healthcheck == nil || strings.Join(healthcheck.Test, " ") != "cat /etc/hosts" {
+		t.Fatalf("Unexpected health check: %#v", healthcheck)
+	}
+	if healthcheck.Interval != 5 || healthcheck.Timeout != 0 || healthcheck.Retries != 2 {
+		t.Fatalf("Unexpected health check options: %#v", healthcheck)
+	}
+}
+
+func TestBuildLabel(t *testing.T) {
+	img := buildImage(testContextTemplate{`
+        from {IMAGE}
+        label team=payments description="Payment service"
+        label tier=backend
+        `,
+		nil, nil}, t, nil, true)
+
+	expected := map[string]string{"team": "payments", "description": "Payment service", "tier": "backend"}
+	if !reflect.DeepEqual(img.Config.Labels, expected) {
+		t.Fatalf("Expected labels %v, got %v", expected, img.Config.Labels)
+	}
+}
+
 // testing #1405 - config.Cmd does not get cleaned up if
 // utilizing cache
 func TestBuildEntrypointRunCleanup(t *testing.T) {
@@ -467,7 +504,10 @@ func TestForbiddenContextPath(t *testing.T) {
 	}
 	port := httpServer.URL[idx+1:]
 
-	ip := srv.runtime.networkManager.bridgeNetwork.IP
+	ip := net.ParseIP("127.0.0.1")
+	if !srv.runtime.networkManager.disabled {
+		ip = srv.runtime.networkManager.bridgeNetwork.IP
+	}
 	dockerfile := constructDockerfile(context.dockerfile, ip, port)
 
 	buildfile := NewBuildFile(srv, ioutil.Discard, false, true)
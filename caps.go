@@ -0,0 +1,154 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Linux capabilities by the names given to run -cap-add and -cap-drop, with
+// their numbers, see capabilities(7).
+var linuxCapabilities = map[string]uintptr{
+	"CHOWN":            0,
+	"DAC_OVERRIDE":     1,
+	"DAC_READ_SEARCH":  2,
+	"FOWNER":           3,
+	"FSETID":           4,
+	"KILL":             5,
+	"SETGID":           6,
+	"SETUID":           7,
+	"SETPCAP":          8,
+	"LINUX_IMMUTABLE":  9,
+	"NET_BIND_SERVICE": 10,
+	"NET_BROADCAST":    11,
+	"NET_ADMIN":        12,
+	"NET_RAW":          13,
+	"IPC_LOCK":         14,
+	"IPC_OWNER":        15,
+	"SYS_MODULE":       16,
+	"SYS_RAWIO":        17,
+	"SYS_CHROOT":       18,
+	"SYS_PTRACE":       19,
+	"SYS_PACCT":        20,
+	"SYS_ADMIN":        21,
+	"SYS_BOOT":         22,
+	"SYS_NICE":         23,
+	"SYS_RESOURCE":     24,
+	"SYS_TIME":         25,
+	"SYS_TTY_CONFIG":   26,
+	"MKNOD":            27,
+	"LEASE":            28,
+	"AUDIT_WRITE":      29,
+	"AUDIT_CONTROL":    30,
+	"SETFCAP":          31,
+	"MAC_OVERRIDE":     32,
+	"MAC_ADMIN":        33,
+	"SYSLOG":           34,
+	"WAKE_ALARM":       35,
+	"BLOCK_SUSPEND":    36,
+	"AUDIT_READ":       37,
+}
+
+// Capabilities unprivileged containers don't have, unless given -cap-add.
+// They keep all the others, unless given -cap-drop.
+var defaultDroppedCapabilities = []string{
+	"AUDIT_CONTROL",
+	"AUDIT_WRITE",
+	"MAC_ADMIN",
+	"MAC_OVERRIDE",
+	"MKNOD",
+	"SETFCAP",
+	"SETPCAP",
+	"SYS_ADMIN",
+	"SYS_BOOT",
+	"SYS_MODULE",
+	"SYS_NICE",
+	"SYS_PACCT",
+	"SYS_RAWIO",
+	"SYS_RESOURCE",
+	"SYS_TIME",
+	"SYS_TTY_CONFIG",
+}
+
+// parseCapabilities checks the values of run -cap-add and -cap-drop, and
+// returns them in the form of linuxCapabilities: net_admin and CAP_NET_ADMIN
+// both become NET_ADMIN. ALL stands for all the capabilities.
+func parseCapabilities(add, drop []string) ([]string, []string, error) {
+	normalize := func(values []string) ([]string, error) {
+		var caps []string
+		for _, value := range values {
+			name := strings.TrimPrefix(strings.ToUpper(value), "CAP_")
+			if _, exists := linuxCapabilities[name]; !exists && name != "ALL" {
+				return nil, fmt.Errorf("Unknown capability: %s", value)
+			}
+			caps = append(caps, name)
+		}
+		return caps, nil
+	}
+	add, err := normalize(add)
+	if err != nil {
+		return nil, nil, err
+	}
+	drop, err = normalize(drop)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range add {
+		for _, d := range drop {
+			if a == d {
+				return nil, nil, fmt.Errorf("Conflicting options: -cap-add and -cap-drop both given %s", a)
+			}
+		}
+	}
+	return add, drop, nil
+}
+
+// droppedCapabilities returns the capabilities the processes of a container
+// with config don't have, SETPCAP last as it is needed to drop the others.
+// Capabilities given by name win over ALL.
+func droppedCapabilities(config *Config) []string {
+	if config.Privileged {
+		return nil
+	}
+	dropped := make(map[string]bool)
+	for _, name := range defaultDroppedCapabilities {
+		dropped[name] = true
+	}
+	for _, name := range config.CapAdd {
+		if name == "ALL" {
+			dropped = make(map[string]bool)
+		}
+	}
+	for _, name := range config.CapDrop {
+		if name == "ALL" {
+			for name := range linuxCapabilities {
+				dropped[name] = true
+			}
+		}
+	}
+	for _, name := range config.CapDrop {
+		if name != "ALL" {
+			dropped[name] = true
+		}
+	}
+	for _, name := range config.CapAdd {
+		delete(dropped, name)
+	}
+
+	var names []string
+	for name := range dropped {
+		if name != "SETPCAP" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if dropped["SETPCAP"] {
+		names = append(names, "SETPCAP")
+	}
+	return names
+}
+
+// lxcDroppedCapabilities returns the value of lxc.cap.drop for config.
+func lxcDroppedCapabilities(config *Config) string {
+	return strings.ToLower(strings.Join(droppedCapabilities(config), " "))
+}
@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	add, drop, err := parseCapabilities([]string{"net_admin", "CAP_SYS_TIME"}, []string{"ALL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(add, " ") != "NET_ADMIN SYS_TIME" || strings.Join(drop, " ") != "ALL" {
+		t.Fatalf("Unexpected capabilities: %v %v", add, drop)
+	}
+	if _, _, err := parseCapabilities([]string{"NET_FOO"}, nil); err == nil {
+		t.Fatalf("Adding an unknown capability should fail")
+	}
+	if _, _, err := parseCapabilities([]string{"MKNOD"}, []string{"mknod"}); err == nil {
+		t.Fatalf("Adding and dropping the same capability should fail")
+	}
+}
+
+func TestDroppedCapabilities(t *testing.T) {
+	dropped := func(config *Config) string {
+		return strings.Join(droppedCapabilities(config), " ")
+	}
+	expected := "AUDIT_CONTROL AUDIT_WRITE MAC_ADMIN MAC_OVERRIDE MKNOD SETFCAP SYS_ADMIN SYS_BOOT SYS_MODULE SYS_NICE SYS_PACCT SYS_RAWIO SYS_RESOURCE SYS_TIME SYS_TTY_CONFIG SETPCAP"
+	if caps := dropped(&Config{}); caps != expected {
+		t.Fatalf("Unexpected default capabilities: %s", caps)
+	}
+	if caps := dropped(&Config{Privileged: true, CapDrop: []string{"NET_RAW"}}); caps != "" {
+		t.Fatalf("Privileged containers should keep all their capabilities, found %s dropped", caps)
+	}
+	caps := dropped(&Config{CapAdd: []string{"SYS_TIME", "MKNOD"}, CapDrop: []string{"NET_RAW"}})
+	if strings.Contains(caps, "SYS_TIME") || strings.Contains(caps, "MKNOD") || !strings.Contains(caps, "NET_RAW") {
+		t.Fatalf("Unexpected capabilities: %s", caps)
+	}
+	if caps := dropped(&Config{CapAdd: []string{"ALL"}, CapDrop: []string{"SETPCAP", "MKNOD"}}); caps != "MKNOD SETPCAP" {
+		t.Fatalf("Expected MKNOD SETPCAP, found %s", caps)
+	}
+	caps = dropped(&Config{CapAdd: []string{"CHOWN"}, CapDrop: []string{"ALL"}})
+	if len(droppedCapabilities(&Config{CapDrop: []string{"ALL"}})) != len(linuxCapabilities) || strings.Contains(caps, "CHOWN") {
+		t.Fatalf("Only CHOWN should have been kept, found %s dropped", caps)
+	}
+}
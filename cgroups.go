@@ -0,0 +1,342 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The control groups of a container live in docker/<id> below the
+// mountpoint of each subsystem. Subsystems which are not mounted are skipped.
+var cgroupSubsystems = []string{"devices", "memory", "cpu", "cpuacct", "cpuset", "blkio", "pids", "freezer"}
+
+// Devices available to unprivileged containers, see LxcTemplate
+var cgroupDevicesAllowed = []string{
+	// /dev/null and zero
+	"c 1:3 rwm",
+	"c 1:5 rwm",
+	// consoles
+	"c 5:1 rwm",
+	"c 5:0 rwm",
+	"c 4:0 rwm",
+	"c 4:1 rwm",
+	// /dev/urandom,/dev/random
+	"c 1:9 rwm",
+	"c 1:8 rwm",
+	// /dev/pts/*
+	"c 136:* rwm",
+	"c 5:2 rwm",
+	// tuntap
+	"c 10:200 rwm",
+}
+
+func cgroupPath(subsystem, id string) (string, error) {
+	mountpoint, err := utils.FindCgroupMountpoint(subsystem)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(mountpoint, "docker", id), nil
+}
+
+// processCgroupPath returns the directory of the control group of the
+// process pid for subsystem, whichever driver created it.
+func processCgroupPath(subsystem string, pid int) (string, error) {
+	mountpoint, err := utils.FindCgroupMountpoint(subsystem)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	// Each line is made of the hierarchy id, the subsystems attached to it
+	// and the path of the group, e.g. 4:memory:/docker/<id>
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, s := range strings.Split(parts[1], ",") {
+			if s == subsystem {
+				return path.Join(mountpoint, parts[2]), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Process %d is in no %s cgroup", pid, subsystem)
+}
+
+func readCgroupUint(dir, file string) (uint64, error) {
+	data, err := ioutil.ReadFile(path.Join(dir, file))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func writeCgroupFile(dir, file, value string) error {
+	if err := ioutil.WriteFile(path.Join(dir, file), []byte(value), 0600); err != nil {
+		return fmt.Errorf("Unable to write %s to %s: %s", value, path.Join(dir, file), err)
+	}
+	return nil
+}
+
+// setupCgroups creates the control groups of the container, applies its
+// limits and moves the process pid into them.
+func setupCgroups(container *Container, pid int) error {
+	for _, subsystem := range cgroupSubsystems {
+		dir, err := cgroupPath(subsystem, container.ID)
+		if err != nil {
+			utils.Debugf("Skipping cgroup subsystem %s: %s", subsystem, err)
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := applyCgroupLimits(container, subsystem, dir); err != nil {
+			return err
+		}
+		if err := writeCgroupFile(dir, "tasks", strconv.Itoa(pid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyCgroupLimits(container *Container, subsystem, dir string) error {
+	config := container.Config
+	switch subsystem {
+	case "devices":
+		if config.Privileged {
+			return writeCgroupFile(dir, "devices.allow", "a")
+		}
+		if err := writeCgroupFile(dir, "devices.deny", "a"); err != nil {
+			return err
+		}
+		for _, device := range cgroupDevicesAllowed {
+			if err := writeCgroupFile(dir, "devices.allow", device); err != nil {
+				return err
+			}
+		}
+		if container.hostConfig == nil {
+			return nil
+		}
+		for _, device := range container.hostConfig.Devices {
+			rule, err := deviceCgroupRule(device)
+			if err != nil {
+				return err
+			}
+			if err := writeCgroupFile(dir, "devices.allow", rule); err != nil {
+				return err
+			}
+		}
+	case "memory":
+		if config.Memory == 0 {
+			return nil
+		}
+		if err := writeCgroupFile(dir, "memory.limit_in_bytes", strconv.FormatInt(config.Memory, 10)); err != nil {
+			return err
+		}
+		if err := writeCgroupFile(dir, "memory.soft_limit_in_bytes", strconv.FormatInt(config.Memory, 10)); err != nil {
+			return err
+		}
+		if memSwap := getMemorySwap(config); memSwap > 0 {
+			if err := writeCgroupFile(dir, "memory.memsw.limit_in_bytes", strconv.FormatInt(memSwap, 10)); err != nil {
+				return err
+			}
+		}
+	case "cpu":
+		if config.CpuShares != 0 {
+			return writeCgroupFile(dir, "cpu.shares", strconv.FormatInt(config.CpuShares, 10))
+		}
+	case "cpuset":
+		// Processes can't join a group without CPUs and memory nodes
+		if err := inheritCpuset(dir); err != nil {
+			return err
+		}
+		if config.CpusetCpus != "" {
+			if err := writeCgroupFile(dir, "cpuset.cpus", config.CpusetCpus); err != nil {
+				return err
+			}
+		}
+		if config.CpusetMems != "" {
+			return writeCgroupFile(dir, "cpuset.mems", config.CpusetMems)
+		}
+	case "blkio":
+		if config.BlkioWeight != 0 {
+			if err := writeCgroupFile(dir, "blkio.weight", strconv.FormatInt(config.BlkioWeight, 10)); err != nil {
+				return err
+			}
+		}
+		for file, devices := range map[string][]ThrottleDevice{
+			"blkio.throttle.read_bps_device":  config.BlkioReadBps,
+			"blkio.throttle.write_bps_device": config.BlkioWriteBps,
+		} {
+			for _, device := range devices {
+				value, err := throttleDevice(device)
+				if err != nil {
+					return err
+				}
+				if err := writeCgroupFile(dir, file, value); err != nil {
+					return err
+				}
+			}
+		}
+	case "pids":
+		if config.PidsLimit != 0 {
+			return writeCgroupFile(dir, "pids.max", strconv.FormatInt(config.PidsLimit, 10))
+		}
+	}
+	return nil
+}
+
+// inheritCpuset gives the cpuset group dir, and its parents below the
+// mountpoint, the CPUs and memory nodes of their parent when they have none,
+// as is the case of new groups.
+func inheritCpuset(dir string) error {
+	mountpoint, err := utils.FindCgroupMountpoint("cpuset")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(dir, mountpoint+"/") {
+		return nil
+	}
+	parent := path.Dir(dir)
+	if err := inheritCpuset(parent); err != nil {
+		return err
+	}
+	for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+		current, err := ioutil.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(current)) != "" {
+			continue
+		}
+		value, err := ioutil.ReadFile(path.Join(parent, file))
+		if err != nil {
+			return err
+		}
+		if err := writeCgroupFile(dir, file, strings.TrimSpace(string(value))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttleDevice returns the line limiting the rate of device in the blkio
+// throttle files, e.g. 8:0 1048576.
+func throttleDevice(device ThrottleDevice) (string, error) {
+	numbers, err := deviceNumbers(device.Path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %d", numbers, device.Rate), nil
+}
+
+// deviceNumbers returns the major and minor numbers of the block device
+// name, as major:minor.
+func deviceNumbers(name string) (string, error) {
+	f, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if f.Mode()&os.ModeDevice == 0 || f.Mode()&os.ModeCharDevice != 0 {
+		return "", fmt.Errorf("%s is not a block device", name)
+	}
+	major, minor := deviceMajorMinor(f)
+	return fmt.Sprintf("%d:%d", major, minor), nil
+}
+
+// discardUnsupportedLimits clears the limits of config the kernel can't
+// enforce, and returns a warning for each of them.
+func discardUnsupportedLimits(config *Config, capabilities *Capabilities) []string {
+	var warnings []string
+	if (config.CpusetCpus != "" || config.CpusetMems != "") && !capabilities.CpusetLimit {
+		warnings = append(warnings, "Your kernel does not support cpuset capabilities. Limitation discarded.")
+		config.CpusetCpus = ""
+		config.CpusetMems = ""
+	}
+	if config.BlkioWeight != 0 && !capabilities.BlkioWeight {
+		warnings = append(warnings, "Your kernel does not support block IO weight capabilities. Limitation discarded.")
+		config.BlkioWeight = 0
+	}
+	if (len(config.BlkioReadBps) > 0 || len(config.BlkioWriteBps) > 0) && !capabilities.BlkioThrottle {
+		warnings = append(warnings, "Your kernel does not support block IO throttling capabilities. Limitation discarded.")
+		config.BlkioReadBps = nil
+		config.BlkioWriteBps = nil
+	}
+	if config.PidsLimit != 0 && !capabilities.PidsLimit {
+		warnings = append(warnings, "Your kernel does not support pids limit capabilities. Limitation discarded.")
+		config.PidsLimit = 0
+	}
+	return warnings
+}
+
+// freezeCgroup sets the freezer of the container id to state, FROZEN or
+// THAWED, and waits for all its processes to reach it.
+func freezeCgroup(id, state string) error {
+	dir, err := cgroupPath("freezer", id)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 1000; i++ {
+		// Freezing can stop half way, when processes are forking: ask again
+		if err := writeCgroupFile(dir, "freezer.state", state); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path.Join(dir, "freezer.state"))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(data)) == state {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("Timeout setting the freezer state of container %s to %s", id, state)
+}
+
+// removeCgroups removes the control groups of the container. They must not
+// contain any process anymore.
+func removeCgroups(id string) error {
+	for _, subsystem := range cgroupSubsystems {
+		dir, err := cgroupPath(subsystem, id)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cgroupPids returns the pids of all the processes in the control groups of
+// the container.
+func cgroupPids(id string) ([]int, error) {
+	dir, err := cgroupPath("devices", id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyCgroupLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-cgroups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	container := &Container{
+		Config: &Config{
+			Memory:    33554432,
+			CpuShares: 512,
+		},
+	}
+	for _, subsystem := range []string{"memory", "cpu"} {
+		if err := applyCgroupLimits(container, subsystem, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]string{
+		"memory.limit_in_bytes":       "33554432",
+		"memory.soft_limit_in_bytes":  "33554432",
+		"memory.memsw.limit_in_bytes": "67108864",
+		"cpu.shares":                  "512",
+	}
+	for file, value := range expected {
+		if content := readFile(path.Join(dir, file), t); content != value {
+			t.Errorf("Expected %s to contain %s, found %s", file, value, content)
+		}
+	}
+
+	// Devices given to run -device come after the default ones
+	container.hostConfig = &HostConfig{Devices: []DeviceMapping{{"/dev/null", "/dev/null", "rw"}}}
+	if err := applyCgroupLimits(container, "devices", dir); err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(path.Join(dir, "devices.allow"), t); strings.TrimSpace(content) != "c 1:3 rw" {
+		t.Errorf("Expected devices.allow to contain c 1:3 rw, found %s", content)
+	}
+
+	// Privileged containers have access to all the devices
+	container.Config.Privileged = true
+	if err := applyCgroupLimits(container, "devices", dir); err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(path.Join(dir, "devices.allow"), t); strings.TrimSpace(content) != "a" {
+		t.Errorf("Expected devices.allow to contain a, found %s", content)
+	}
+}
+
+func TestNotifyOOM(t *testing.T) {
+	mountpoint, err := utils.FindCgroupMountpoint("memory")
+	if unitTestFake || err != nil {
+		t.Skip("The memory cgroup is not available")
+	}
+	dir, err := ioutil.TempDir(mountpoint, "docker-test-oom-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
+	for _, file := range []string{"memory.limit_in_bytes", "memory.memsw.limit_in_bytes"} {
+		if err := ioutil.WriteFile(path.Join(dir, file), []byte("8388608"), 0644); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+	oom, err := notifyOOM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// dd allocates a buffer of the size of its blocks
+	cmd := exec.Command("sh", "-c", "echo $$ > "+path.Join(dir, "tasks")+"; exec dd if=/dev/zero of=/dev/null bs=64M count=1")
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("The process should have been killed")
+	}
+	setTimeout(t, "The OOM kill should have been notified", 2*time.Second, func() {
+		<-oom
+	})
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	setTimeout(t, "The removal of the group should close the channel", 2*time.Second, func() {
+		for _ = range oom {
+		}
+	})
+}
+
+func TestApplyCgroupResourceLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-cgroups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	container := &Container{
+		Config: &Config{
+			CpusetCpus:  "0-1",
+			CpusetMems:  "0",
+			BlkioWeight: 300,
+			PidsLimit:   100,
+		},
+	}
+	for _, subsystem := range []string{"cpuset", "blkio", "pids"} {
+		if err := applyCgroupLimits(container, subsystem, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]string{
+		"cpuset.cpus":  "0-1",
+		"cpuset.mems":  "0",
+		"blkio.weight": "300",
+		"pids.max":     "100",
+	}
+	for file, value := range expected {
+		if content := readFile(path.Join(dir, file), t); content != value {
+			t.Errorf("Expected %s to contain %s, found %s", file, value, content)
+		}
+	}
+
+	// Only block devices can be throttled
+	container.Config.BlkioReadBps = []ThrottleDevice{{Path: "/dev/null", Rate: 1024}}
+	if err := applyCgroupLimits(container, "blkio", dir); err == nil {
+		t.Fatalf("Throttling /dev/null should have failed")
+	}
+
+	warnings := discardUnsupportedLimits(container.Config, &Capabilities{CpusetLimit: true})
+	if len(warnings) != 3 || container.Config.CpusetCpus != "0-1" || container.Config.BlkioWeight != 0 ||
+		container.Config.BlkioReadBps != nil || container.Config.PidsLimit != 0 {
+		t.Fatalf("Only the cpuset limits should have been kept: %v", warnings)
+	}
+}
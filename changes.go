@@ -33,7 +33,21 @@ func (change *Change) String() string {
 	return fmt.Sprintf("%s %s", kind, change.Path)
 }
 
+// Changes lists the changes recorded in the read-write layer rw on top of
+// layers, in the AUFS format.
 func Changes(layers []string, rw string) ([]Change, error) {
+	return changes(layers, rw, func(path string, f os.FileInfo) (string, bool) {
+		file := filepath.Base(path)
+		if strings.HasPrefix(file, ".wh.") {
+			return filepath.Join(filepath.Dir(path), file[len(".wh."):]), true
+		}
+		return "", false
+	})
+}
+
+// changes lists the changes recorded in rw. whiteout tells whether the entry
+// at path in rw records the removal of a file, and which one.
+func changes(layers []string, rw string, whiteout func(path string, f os.FileInfo) (string, bool)) ([]Change, error) {
 	var changes []Change
 	err := filepath.Walk(rw, func(path string, f os.FileInfo, err error) error {
 		if err != nil {
@@ -62,11 +76,9 @@ func Changes(layers []string, rw string) ([]Change, error) {
 		}
 
 		// Find out what kind of modification happened
-		file := filepath.Base(path)
 		// If there is a whiteout, then the file was removed
-		if strings.HasPrefix(file, ".wh.") {
-			originalFile := file[len(".wh."):]
-			change.Path = filepath.Join(filepath.Dir(path), originalFile)
+		if originalPath, isWhiteout := whiteout(path, f); isWhiteout {
+			change.Path = originalPath
 			change.Kind = ChangeDelete
 		} else {
 			// Otherwise, the file was added
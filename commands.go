@@ -22,8 +22,10 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"text/tabwriter"
+	"text/template"
 	"time"
 	"unicode"
 )
@@ -80,6 +82,7 @@ func (cli *DockerCli) CmdHelp(args ...string) error {
 		{"cp", "Copy files/folders from the containers filesystem to the host path"},
 		{"diff", "Inspect changes on a container's filesystem"},
 		{"events", "Get real time events from the server"},
+		{"exec", "Run a command in a running container"},
 		{"export", "Stream the contents of a container as a tar archive"},
 		{"history", "Show the history of an image"},
 		{"images", "List images"},
@@ -91,18 +94,22 @@ func (cli *DockerCli) CmdHelp(args ...string) error {
 		{"login", "Register or Login to the docker registry server"},
 		{"logs", "Fetch the logs of a container"},
 		{"port", "Lookup the public-facing port which is NAT-ed to PRIVATE_PORT"},
+		{"pause", "Pause all the processes of a container"},
 		{"top", "Lookup the running processes of a container"},
 		{"ps", "List containers"},
 		{"pull", "Pull an image or a repository from the docker registry server"},
 		{"push", "Push an image or a repository to the docker registry server"},
+		{"rename", "Rename a container"},
 		{"restart", "Restart a running container"},
 		{"rm", "Remove one or more containers"},
 		{"rmi", "Remove one or more images"},
 		{"run", "Run a command in a new container"},
 		{"search", "Search for an image in the docker index"},
 		{"start", "Start a stopped container"},
+		{"stats", "Display a live stream of the resource usage of containers"},
 		{"stop", "Stop a running container"},
 		{"tag", "Tag an image into a repository"},
+		{"unpause", "Unpause all the processes of a container"},
 		{"version", "Show the docker version information"},
 		{"wait", "Block until a container stops, then print its exit code"},
 	} {
@@ -143,6 +150,7 @@ func mkBuildContext(dockerfile string, files [][2]string) (Archive, error) {
 		hdr := &tar.Header{
 			Name: name,
 			Size: int64(len(content)),
+			Mode: 0600,
 		}
 		if err := tw.WriteHeader(hdr); err != nil {
 			return nil, err
@@ -494,6 +502,12 @@ func (cli *DockerCli) CmdInfo(args ...string) error {
 
 	fmt.Fprintf(cli.out, "Containers: %d\n", out.Containers)
 	fmt.Fprintf(cli.out, "Images: %d\n", out.Images)
+	if out.ExecutionDriver != "" {
+		fmt.Fprintf(cli.out, "Execution Driver: %s\n", out.ExecutionDriver)
+	}
+	if out.StorageDriver != "" {
+		fmt.Fprintf(cli.out, "Storage Driver: %s\n", out.StorageDriver)
+	}
 	if out.Debug || os.Getenv("DEBUG") != "" {
 		fmt.Fprintf(cli.out, "Debug mode (server): %v\n", out.Debug)
 		fmt.Fprintf(cli.out, "Debug mode (client): %v\n", os.Getenv("DEBUG") != "")
@@ -524,6 +538,105 @@ func (cli *DockerCli) CmdInfo(args ...string) error {
 	return nil
 }
 
+func (cli *DockerCli) CmdStats(args ...string) error {
+	cmd := Subcmd("stats", "CONTAINER [CONTAINER...]", "Display a live stream of the resource usage of containers")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+
+	// The two last samples of each container, the CPU usage is the
+	// difference between them
+	type containerStats struct {
+		previous, current *APIStats
+		err               error
+	}
+	var (
+		lock    sync.Mutex
+		stats   = make([]containerStats, cmd.NArg())
+		streams sync.WaitGroup
+	)
+	for i, name := range cmd.Args() {
+		streams.Add(1)
+		go func(i int, name string) {
+			defer streams.Done()
+			r, w := io.Pipe()
+			go func() {
+				w.CloseWithError(cli.streamHelper("GET", "/containers/"+name+"/stats", false, nil, w))
+			}()
+			dec := json.NewDecoder(r)
+			for {
+				sample := &APIStats{}
+				err := dec.Decode(sample)
+				lock.Lock()
+				if err != nil {
+					if err == io.EOF {
+						err = fmt.Errorf("Container %s is not running", name)
+					}
+					stats[i].err = err
+					lock.Unlock()
+					return
+				}
+				stats[i].previous, stats[i].current = stats[i].current, sample
+				lock.Unlock()
+			}
+		}(i, name)
+	}
+	done := make(chan struct{})
+	go func() {
+		streams.Wait()
+		close(done)
+	}()
+
+	for {
+		var finished bool
+		select {
+		case <-done:
+			finished = true
+		case <-time.After(time.Second):
+		}
+		if cli.isTerminal {
+			// Clear the screen
+			fmt.Fprint(cli.out, "\033[2J\033[H")
+		}
+		w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+		fmt.Fprintln(w, "CONTAINER\tCPU %\tMEM USAGE/LIMIT\tMEM %\tNET I/O\tBLOCK I/O")
+		lock.Lock()
+		for i, name := range cmd.Args() {
+			s := stats[i]
+			switch {
+			case s.err != nil:
+				fmt.Fprintf(w, "%s\t%s\n", name, s.err)
+			case s.current == nil:
+				fmt.Fprintf(w, "%s\t--\t--\t--\t--\t--\n", name)
+			default:
+				cpu := "--"
+				if s.previous != nil {
+					if elapsed := s.current.Read.Sub(s.previous.Read); elapsed > 0 {
+						cpu = fmt.Sprintf("%.2f%%", float64(s.current.CPUUsage-s.previous.CPUUsage)/float64(elapsed)*100)
+					}
+				}
+				mem := "--"
+				if s.current.MemoryLimit != 0 {
+					mem = fmt.Sprintf("%.2f%%", float64(s.current.MemoryUsage)/float64(s.current.MemoryLimit)*100)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s / %s\t%s\t%s / %s\t%s / %s\n", name, cpu,
+					utils.HumanSize(int64(s.current.MemoryUsage)), utils.HumanSize(int64(s.current.MemoryLimit)), mem,
+					utils.HumanSize(int64(s.current.RxBytes)), utils.HumanSize(int64(s.current.TxBytes)),
+					utils.HumanSize(int64(s.current.BlkioRead)), utils.HumanSize(int64(s.current.BlkioWrite)))
+			}
+		}
+		lock.Unlock()
+		w.Flush()
+		if finished {
+			return nil
+		}
+	}
+}
+
 func (cli *DockerCli) CmdStop(args ...string) error {
 	cmd := Subcmd("stop", "[OPTIONS] CONTAINER [CONTAINER...]", "Stop a running container")
 	nSeconds := cmd.Int("t", 10, "Number of seconds to wait for the container to stop before killing it.")
@@ -549,6 +662,65 @@ func (cli *DockerCli) CmdStop(args ...string) error {
 	return nil
 }
 
+func (cli *DockerCli) CmdPause(args ...string) error {
+	cmd := Subcmd("pause", "CONTAINER [CONTAINER...]", "Pause all the processes of a container")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+
+	for _, name := range cmd.Args() {
+		if _, _, err := cli.call("POST", "/containers/"+name+"/pause", nil); err != nil {
+			fmt.Fprintf(cli.err, "%s\n", err)
+		} else {
+			fmt.Fprintf(cli.out, "%s\n", name)
+		}
+	}
+	return nil
+}
+
+func (cli *DockerCli) CmdUnpause(args ...string) error {
+	cmd := Subcmd("unpause", "CONTAINER [CONTAINER...]", "Unpause all the processes of a container")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+
+	for _, name := range cmd.Args() {
+		if _, _, err := cli.call("POST", "/containers/"+name+"/unpause", nil); err != nil {
+			fmt.Fprintf(cli.err, "%s\n", err)
+		} else {
+			fmt.Fprintf(cli.out, "%s\n", name)
+		}
+	}
+	return nil
+}
+
+func (cli *DockerCli) CmdRename(args ...string) error {
+	cmd := Subcmd("rename", "CONTAINER NEW_NAME", "Rename a container")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() != 2 {
+		cmd.Usage()
+		return nil
+	}
+
+	v := url.Values{}
+	v.Set("name", cmd.Arg(1))
+
+	if _, _, err := cli.call("POST", "/containers/"+cmd.Arg(0)+"/rename?"+v.Encode(), nil); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (cli *DockerCli) CmdRestart(args ...string) error {
 	cmd := Subcmd("restart", "[OPTIONS] CONTAINER [CONTAINER...]", "Restart a running container")
 	nSeconds := cmd.Int("t", 10, "Number of seconds to try to stop for before killing the container. Once killed it will then be restarted. Default=10")
@@ -598,7 +770,8 @@ func (cli *DockerCli) CmdStart(args ...string) error {
 }
 
 func (cli *DockerCli) CmdInspect(args ...string) error {
-	cmd := Subcmd("inspect", "CONTAINER|IMAGE [CONTAINER|IMAGE...]", "Return low-level information on a container/image")
+	cmd := Subcmd("inspect", "[OPTIONS] CONTAINER|IMAGE [CONTAINER|IMAGE...]", "Return low-level information on a container/image")
+	flFormat := cmd.String("format", "", "Format the output using the given Go template")
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
@@ -606,13 +779,21 @@ func (cli *DockerCli) CmdInspect(args ...string) error {
 		cmd.Usage()
 		return nil
 	}
-	fmt.Fprintf(cli.out, "[")
-	for i, name := range args {
-		if i > 0 {
+	tmpl, err := parseFormat(*flFormat)
+	if err != nil {
+		return err
+	}
+	if tmpl == nil {
+		fmt.Fprintf(cli.out, "[")
+	}
+	for i, name := range cmd.Args() {
+		if i > 0 && tmpl == nil {
 			fmt.Fprintf(cli.out, ",")
 		}
+		var v interface{} = &Container{}
 		obj, _, err := cli.call("GET", "/containers/"+name+"/json", nil)
 		if err != nil {
+			v = &Image{}
 			obj, _, err = cli.call("GET", "/images/"+name+"/json", nil)
 			if err != nil {
 				fmt.Fprintf(cli.err, "%s\n", err)
@@ -620,6 +801,17 @@ func (cli *DockerCli) CmdInspect(args ...string) error {
 			}
 		}
 
+		if tmpl != nil {
+			if err := json.Unmarshal(obj, v); err != nil {
+				fmt.Fprintf(cli.err, "%s\n", err)
+				continue
+			}
+			if err := formatOutput(cli.out, tmpl, v); err != nil {
+				fmt.Fprintf(cli.err, "%s\n", err)
+			}
+			continue
+		}
+
 		indented := new(bytes.Buffer)
 		if err = json.Indent(indented, obj, "", "    "); err != nil {
 			fmt.Fprintf(cli.err, "%s\n", err)
@@ -629,7 +821,9 @@ func (cli *DockerCli) CmdInspect(args ...string) error {
 			fmt.Fprintf(cli.err, "%s\n", err)
 		}
 	}
-	fmt.Fprintf(cli.out, "]")
+	if tmpl == nil {
+		fmt.Fprintf(cli.out, "]")
+	}
 	return nil
 }
 
@@ -734,7 +928,8 @@ func (cli *DockerCli) CmdRmi(args ...string) error {
 }
 
 func (cli *DockerCli) CmdHistory(args ...string) error {
-	cmd := Subcmd("history", "IMAGE", "Show the history of an image")
+	cmd := Subcmd("history", "[OPTIONS] IMAGE", "Show the history of an image")
+	flFormat := cmd.String("format", "", "Format the output using the given Go template")
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
@@ -742,6 +937,10 @@ func (cli *DockerCli) CmdHistory(args ...string) error {
 		cmd.Usage()
 		return nil
 	}
+	tmpl, err := parseFormat(*flFormat)
+	if err != nil {
+		return err
+	}
 
 	body, _, err := cli.call("GET", "/images/"+cmd.Arg(0)+"/history", nil)
 	if err != nil {
@@ -753,6 +952,14 @@ func (cli *DockerCli) CmdHistory(args ...string) error {
 	if err != nil {
 		return err
 	}
+	if tmpl != nil {
+		for _, out := range outs {
+			if err := formatOutput(cli.out, tmpl, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
 	fmt.Fprintln(w, "ID\tCREATED\tCREATED BY")
 
@@ -793,7 +1000,8 @@ func (cli *DockerCli) CmdRm(args ...string) error {
 
 // 'docker kill NAME' kills a running container
 func (cli *DockerCli) CmdKill(args ...string) error {
-	cmd := Subcmd("kill", "CONTAINER [CONTAINER...]", "Kill a running container")
+	cmd := Subcmd("kill", "[OPTIONS] CONTAINER [CONTAINER...]", "Kill a running container, or send it a signal")
+	flSignal := cmd.String("s", "KILL", "Signal to send to the container")
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
@@ -802,8 +1010,10 @@ func (cli *DockerCli) CmdKill(args ...string) error {
 		return nil
 	}
 
-	for _, name := range args {
-		_, _, err := cli.call("POST", "/containers/"+name+"/kill", nil)
+	v := url.Values{}
+	v.Set("signal", *flSignal)
+	for _, name := range cmd.Args() {
+		_, _, err := cli.call("POST", "/containers/"+name+"/kill?"+v.Encode(), nil)
 		if err != nil {
 			fmt.Fprintf(cli.err, "%s\n", err)
 		} else {
@@ -919,6 +1129,9 @@ func (cli *DockerCli) CmdImages(args ...string) error {
 	all := cmd.Bool("a", false, "show all images")
 	noTrunc := cmd.Bool("notrunc", false, "Don't truncate output")
 	flViz := cmd.Bool("viz", false, "output graph in graphviz format")
+	flFormat := cmd.String("format", "", "Format the output using the given Go template")
+	var flFilters ListOpts
+	cmd.Var(&flFilters, "f", "Filter output based on conditions provided (label=key[=value], dangling=true, ancestor=image, name=pattern, created-before=timestamp, created-after=timestamp)")
 
 	if err := cmd.Parse(args); err != nil {
 		return nil
@@ -927,6 +1140,10 @@ func (cli *DockerCli) CmdImages(args ...string) error {
 		cmd.Usage()
 		return nil
 	}
+	tmpl, err := parseFormat(*flFormat)
+	if err != nil {
+		return err
+	}
 
 	if *flViz {
 		body, _, err := cli.call("GET", "/images/viz", false)
@@ -942,6 +1159,13 @@ func (cli *DockerCli) CmdImages(args ...string) error {
 		if *all {
 			v.Set("all", "1")
 		}
+		if len(flFilters) > 0 {
+			filters, err := filtersFromFlags(flFilters)
+			if err != nil {
+				return err
+			}
+			v.Set("filters", filters)
+		}
 
 		body, _, err := cli.call("GET", "/images/json?"+v.Encode(), nil)
 		if err != nil {
@@ -955,7 +1179,7 @@ func (cli *DockerCli) CmdImages(args ...string) error {
 		}
 
 		w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
-		if !*quiet {
+		if !*quiet && tmpl == nil {
 			fmt.Fprintln(w, "REPOSITORY\tTAG\tID\tCREATED\tSIZE")
 		}
 
@@ -967,7 +1191,11 @@ func (cli *DockerCli) CmdImages(args ...string) error {
 				out.Tag = "<none>"
 			}
 
-			if !*quiet {
+			if tmpl != nil {
+				if err := formatOutput(cli.out, tmpl, out); err != nil {
+					return err
+				}
+			} else if !*quiet {
 				fmt.Fprintf(w, "%s\t%s\t", out.Repository, out.Tag)
 				if *noTrunc {
 					fmt.Fprintf(w, "%s\t", out.ID)
@@ -1006,10 +1234,17 @@ func (cli *DockerCli) CmdPs(args ...string) error {
 	since := cmd.String("sinceId", "", "Show only containers created since Id, include non-running ones.")
 	before := cmd.String("beforeId", "", "Show only container created before Id, include non-running ones.")
 	last := cmd.Int("n", -1, "Show n last created containers, include non-running ones.")
+	flFormat := cmd.String("format", "", "Format the output using the given Go template")
+	var flFilters ListOpts
+	cmd.Var(&flFilters, "f", "Filter output based on conditions provided (label=key[=value], status=exited, exited=code, ancestor=image, name=pattern, created-before=timestamp, created-after=timestamp)")
 
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
+	tmpl, err := parseFormat(*flFormat)
+	if err != nil {
+		return err
+	}
 	v := url.Values{}
 	if *last == -1 && *nLatest {
 		*last = 1
@@ -1029,6 +1264,13 @@ func (cli *DockerCli) CmdPs(args ...string) error {
 	if *size {
 		v.Set("size", "1")
 	}
+	if len(flFilters) > 0 {
+		filters, err := filtersFromFlags(flFilters)
+		if err != nil {
+			return err
+		}
+		v.Set("filters", filters)
+	}
 
 	body, _, err := cli.call("GET", "/containers/json?"+v.Encode(), nil)
 	if err != nil {
@@ -1040,9 +1282,17 @@ func (cli *DockerCli) CmdPs(args ...string) error {
 	if err != nil {
 		return err
 	}
+	if tmpl != nil {
+		for _, out := range outs {
+			if err := formatOutput(cli.out, tmpl, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
 	if !*quiet {
-		fmt.Fprint(w, "ID\tIMAGE\tCOMMAND\tCREATED\tSTATUS\tPORTS")
+		fmt.Fprint(w, "ID\tIMAGE\tCOMMAND\tCREATED\tSTATUS\tPORTS\tNAME")
 		if *size {
 			fmt.Fprintln(w, "\tSIZE")
 		} else {
@@ -1053,9 +1303,9 @@ func (cli *DockerCli) CmdPs(args ...string) error {
 	for _, out := range outs {
 		if !*quiet {
 			if *noTrunc {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\t%s\t", out.ID, out.Image, out.Command, utils.HumanDuration(time.Now().Sub(time.Unix(out.Created, 0))), out.Status, out.Ports)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\t%s\t%s\t", out.ID, out.Image, out.Command, utils.HumanDuration(time.Now().Sub(time.Unix(out.Created, 0))), out.Status, out.Ports, out.Name)
 			} else {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\t%s\t", utils.TruncateID(out.ID), out.Image, utils.Trunc(out.Command, 20), utils.HumanDuration(time.Now().Sub(time.Unix(out.Created, 0))), out.Status, out.Ports)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\t%s\t%s\t", utils.TruncateID(out.ID), out.Image, utils.Trunc(out.Command, 20), utils.HumanDuration(time.Now().Sub(time.Unix(out.Created, 0))), out.Status, out.Ports, out.Name)
 			}
 			if *size {
 				if out.SizeRootFs > 0 {
@@ -1086,6 +1336,7 @@ func (cli *DockerCli) CmdCommit(args ...string) error {
 	flComment := cmd.String("m", "", "Commit message")
 	flAuthor := cmd.String("author", "", "Author (eg. \"John Hannibal Smith <hannibal@a-team.com>\"")
 	flConfig := cmd.String("run", "", "Config automatically applied when the image is run. "+`(ex: {"Cmd": ["cat", "/world"], "PortSpecs": ["22"]}')`)
+	flPause := cmd.Bool("pause", false, "Pause the container while its changes are committed")
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
@@ -1101,6 +1352,9 @@ func (cli *DockerCli) CmdCommit(args ...string) error {
 	v.Set("tag", tag)
 	v.Set("comment", *flComment)
 	v.Set("author", *flAuthor)
+	if *flPause {
+		v.Set("pause", "1")
+	}
 	var config *Config
 	if *flConfig != "" {
 		config = &Config{}
@@ -1126,6 +1380,9 @@ func (cli *DockerCli) CmdCommit(args ...string) error {
 func (cli *DockerCli) CmdEvents(args ...string) error {
 	cmd := Subcmd("events", "[OPTIONS]", "Get real time events from the server")
 	since := cmd.String("since", "", "Show events previously created (used for polling).")
+	flFormat := cmd.String("format", "", "Format the output using the given Go template")
+	var flFilters ListOpts
+	cmd.Var(&flFilters, "f", "Filter output based on conditions provided (label=key[=value])")
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
@@ -1134,18 +1391,53 @@ func (cli *DockerCli) CmdEvents(args ...string) error {
 		cmd.Usage()
 		return nil
 	}
+	tmpl, err := parseFormat(*flFormat)
+	if err != nil {
+		return err
+	}
 
 	v := url.Values{}
 	if *since != "" {
 		v.Set("since", *since)
 	}
+	if len(flFilters) > 0 {
+		filters, err := filtersFromFlags(flFilters)
+		if err != nil {
+			return err
+		}
+		v.Set("filters", filters)
+	}
 
+	if tmpl != nil {
+		return cli.formatEvents("/events?"+v.Encode(), tmpl)
+	}
 	if err := cli.stream("GET", "/events?"+v.Encode(), nil, cli.out); err != nil {
 		return err
 	}
 	return nil
 }
 
+// formatEvents writes the events streamed from path with tmpl, one per line.
+func (cli *DockerCli) formatEvents(path string, tmpl *template.Template) error {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(cli.streamHelper("GET", path, false, nil, w))
+	}()
+	defer r.Close()
+	dec := json.NewDecoder(r)
+	for {
+		var event utils.JSONMessage
+		if err := dec.Decode(&event); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := formatOutput(cli.out, tmpl, event); err != nil {
+			return err
+		}
+	}
+}
+
 func (cli *DockerCli) CmdExport(args ...string) error {
 	cmd := Subcmd("export", "CONTAINER", "Export the contents of a filesystem as a tar archive")
 	if err := cmd.Parse(args); err != nil {
@@ -1231,7 +1523,7 @@ func (cli *DockerCli) CmdAttach(args ...string) error {
 	}
 
 	if container.Config.Tty {
-		if err := cli.monitorTtySize(cmd.Arg(0)); err != nil {
+		if err := cli.monitorTtySize("/containers/" + cmd.Arg(0)); err != nil {
 			return err
 		}
 	}
@@ -1248,6 +1540,64 @@ func (cli *DockerCli) CmdAttach(args ...string) error {
 	return nil
 }
 
+func (cli *DockerCli) CmdExec(args ...string) error {
+	cmd := Subcmd("exec", "[OPTIONS] CONTAINER COMMAND [ARG...]", "Run a command in a running container")
+	flStdin := cmd.Bool("i", false, "Keep stdin open even if not attached")
+	flTty := cmd.Bool("t", false, "Allocate a pseudo-tty")
+	flUser := cmd.String("u", "", "Username or UID, with an optional group (user[:group])")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 2 {
+		cmd.Usage()
+		return nil
+	}
+
+	config := &ExecConfig{
+		User:      *flUser,
+		Tty:       *flTty,
+		OpenStdin: *flStdin,
+		Cmd:       cmd.Args()[1:],
+	}
+	body, _, err := cli.call("POST", "/containers/"+cmd.Arg(0)+"/exec", config)
+	if err != nil {
+		return err
+	}
+	execResult := &APIID{}
+	if err := json.Unmarshal(body, execResult); err != nil {
+		return err
+	}
+
+	if config.Tty && cli.isTerminal {
+		if err := cli.monitorTtySize("/exec/" + execResult.ID); err != nil {
+			utils.Debugf("Error monitoring TTY size: %s\n", err)
+		}
+	}
+
+	v := url.Values{}
+	var in io.ReadCloser
+	if config.OpenStdin {
+		v.Set("stdin", "1")
+		in = cli.in
+	}
+	if err := cli.hijack("POST", "/exec/"+execResult.ID+"/start?"+v.Encode(), config.Tty, in, cli.out); err != nil {
+		return err
+	}
+
+	body, _, err = cli.call("POST", "/exec/"+execResult.ID+"/wait", nil)
+	if err != nil {
+		return err
+	}
+	waitResult := &APIWait{}
+	if err := json.Unmarshal(body, waitResult); err != nil {
+		return err
+	}
+	if waitResult.StatusCode != 0 {
+		return &utils.StatusError{Status: waitResult.StatusCode}
+	}
+	return nil
+}
+
 func (cli *DockerCli) CmdSearch(args ...string) error {
 	cmd := Subcmd("search", "NAME", "Search the docker index for images")
 	noTrunc := cmd.Bool("notrunc", false, "Don't truncate output")
@@ -1414,8 +1764,13 @@ func (cli *DockerCli) CmdRun(args ...string) error {
 		defer containerIDFile.Close()
 	}
 
+	containerValues := url.Values{}
+	if name := cmd.Lookup("name").Value.String(); name != "" {
+		containerValues.Set("name", name)
+	}
+
 	//create the container
-	body, statusCode, err := cli.call("POST", "/containers/create", config)
+	body, statusCode, err := cli.call("POST", "/containers/create?"+containerValues.Encode(), config)
 	//if image not found try to pull it
 	if statusCode == 404 {
 		_, tag := utils.ParseRepositoryTag(config.Image)
@@ -1433,7 +1788,7 @@ func (cli *DockerCli) CmdRun(args ...string) error {
 		if err != nil {
 			return err
 		}
-		body, _, err = cli.call("POST", "/containers/create", config)
+		body, _, err = cli.call("POST", "/containers/create?"+containerValues.Encode(), config)
 		if err != nil {
 			return err
 		}
@@ -1475,7 +1830,7 @@ func (cli *DockerCli) CmdRun(args ...string) error {
 
 	if config.AttachStdin || config.AttachStdout || config.AttachStderr {
 		if config.Tty {
-			if err := cli.monitorTtySize(runResult.ID); err != nil {
+			if err := cli.monitorTtySize("/containers/" + runResult.ID); err != nil {
 				utils.Debugf("Error monitoring TTY size: %s\n", err)
 			}
 		}
@@ -1607,6 +1962,12 @@ func (cli *DockerCli) call(method, path string, data interface{}) ([]byte, int,
 }
 
 func (cli *DockerCli) stream(method, path string, in io.Reader, out io.Writer) error {
+	return cli.streamHelper(method, path, true, in, out)
+}
+
+// streamHelper copies the body of the response to out. JSON messages are
+// displayed as they arrive if displayJSON is set, and copied as is otherwise.
+func (cli *DockerCli) streamHelper(method, path string, displayJSON bool, in io.Reader, out io.Writer) error {
 	if (method == "POST" || method == "PUT") && in == nil {
 		in = bytes.NewReader([]byte{})
 	}
@@ -1648,7 +2009,7 @@ func (cli *DockerCli) stream(method, path string, in io.Reader, out io.Writer) e
 		return fmt.Errorf("Error: %s", body)
 	}
 
-	if matchesContentType(resp.Header.Get("Content-Type"), "application/json") {
+	if matchesContentType(resp.Header.Get("Content-Type"), "application/json") && displayJSON {
 		return utils.DisplayJSONMessagesStream(resp.Body, out)
 	} else {
 		if _, err := io.Copy(out, resp.Body); err != nil {
@@ -1750,7 +2111,9 @@ func (cli *DockerCli) getTtySize() (int, int) {
 	return int(ws.Height), int(ws.Width)
 }
 
-func (cli *DockerCli) resizeTty(id string) {
+// resizeTty sets the size of the tty of the container or exec at path, as
+// in /containers/<id>, to the one of the terminal.
+func (cli *DockerCli) resizeTty(path string) {
 	height, width := cli.getTtySize()
 	if height == 0 && width == 0 {
 		return
@@ -1758,22 +2121,22 @@ func (cli *DockerCli) resizeTty(id string) {
 	v := url.Values{}
 	v.Set("h", strconv.Itoa(height))
 	v.Set("w", strconv.Itoa(width))
-	if _, _, err := cli.call("POST", "/containers/"+id+"/resize?"+v.Encode(), nil); err != nil {
+	if _, _, err := cli.call("POST", path+"/resize?"+v.Encode(), nil); err != nil {
 		utils.Debugf("Error resize: %s", err)
 	}
 }
 
-func (cli *DockerCli) monitorTtySize(id string) error {
+func (cli *DockerCli) monitorTtySize(path string) error {
 	if !cli.isTerminal {
 		return fmt.Errorf("Impossible to monitor size on non-tty")
 	}
-	cli.resizeTty(id)
+	cli.resizeTty(path)
 
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGWINCH)
 	go func() {
 		for _ = range sigchan {
-			cli.resizeTty(id)
+			cli.resizeTty(path)
 		}
 	}()
 	return nil
@@ -2,6 +2,8 @@ package docker
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/dotcloud/docker/utils"
 	"io"
@@ -61,6 +63,9 @@ func assertPipe(input, output string, r io.Reader, w io.Writer, count int) error
 
 // TestRunHostname checks that 'docker run -h' correctly sets a custom hostname
 func TestRunHostname(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't create a UTS namespace")
+	}
 	stdout, stdoutPipe := io.Pipe()
 
 	cli := NewDockerCli(nil, stdoutPipe, ioutil.Discard, testDaemonProto, testDaemonAddr)
@@ -90,8 +95,55 @@ func TestRunHostname(t *testing.T) {
 
 }
 
+// TestFormat checks that -format prints the output of images, history and
+// inspect with the given template
+func TestFormat(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	cli := NewDockerCli(nil, stdout, ioutil.Discard, testDaemonProto, testDaemonAddr)
+	defer cleanup(globalRuntime)
+
+	if err := cli.CmdImages("-format", "{{.Repository}}:{{.Tag}} {{truncate .ID 12}}", unitTestImageName); err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("%s:latest %s\n", unitTestImageName, utils.TruncateID(unitTestImageID))
+	if stdout.String() != expected {
+		t.Fatalf("'images -format' should display '%s', not '%s'", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	if err := cli.CmdHistory("-format", "{{upper (truncate .ID 4)}} {{join .Tags \",\"}}", unitTestImageID); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stdout.String(), strings.ToUpper(unitTestImageID[:4])+" "+unitTestImageName+":latest\n") {
+		t.Fatalf("Unexpected output of 'history -format': '%s'", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := cli.CmdInspect("-format", "{{.ID}} {{json .Config}}", unitTestImageID); err != nil {
+		t.Fatal(err)
+	}
+	image, err := globalRuntime.graph.Get(unitTestImageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := json.Marshal(image.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := unitTestImageID + " " + string(config) + "\n"; stdout.String() != expected {
+		t.Fatalf("'inspect -format' should display '%s', not '%s'", expected, stdout.String())
+	}
+
+	if err := cli.CmdPs("-format", "{{.ID"); err == nil {
+		t.Fatalf("Expected an invalid format to be an error")
+	}
+}
+
 // TestRunWorkdir checks that 'docker run -w' correctly sets a custom working directory
 func TestRunWorkdir(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	stdout, stdoutPipe := io.Pipe()
 
 	cli := NewDockerCli(nil, stdoutPipe, ioutil.Discard, testDaemonProto, testDaemonAddr)
@@ -123,6 +175,9 @@ func TestRunWorkdir(t *testing.T) {
 
 // TestRunWorkdirExists checks that 'docker run -w' correctly sets a custom working directory, even if it exists
 func TestRunWorkdirExists(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	stdout, stdoutPipe := io.Pipe()
 
 	cli := NewDockerCli(nil, stdoutPipe, ioutil.Discard, testDaemonProto, testDaemonAddr)
@@ -11,6 +11,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"path"
@@ -18,15 +19,16 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
-	"net"
 )
 
 type Container struct {
 	root string
 
-	ID string
+	ID   string
+	Name string
 
 	Created time.Time
 
@@ -42,6 +44,7 @@ type Container struct {
 
 	SysInitPath    string
 	ResolvConfPath string
+	HostsPath      string
 
 	cmd       *exec.Cmd
 	stdout    *utils.WriteBroadcaster
@@ -52,6 +55,30 @@ type Container struct {
 
 	runtime *Runtime
 
+	// Environment variables describing the containers it is linked to
+	linkEnv []string
+
+	// Host configuration of the last start, read by the execution drivers
+	hostConfig *HostConfig
+
+	// Daemon ends of the FIFOs of the standard streams, and their copies
+	fifos   []*os.File
+	streams sync.WaitGroup
+
+	// manualStop is set when the container is stopped or killed on
+	// purpose, so that its restart policy doesn't apply
+	manualStop   bool
+	restartDelay time.Duration
+
+	// Closed to stop the health check when the process exits
+	healthStop chan struct{}
+	// Set when the kernel killed a process of the container for lack of
+	// memory. oomDone is closed once all the OOM kills of the current process
+	// are recorded. Both are guarded by oomLock.
+	oomKilled bool
+	oomDone   chan struct{}
+	oomLock   sync.Mutex
+
 	waitLock chan struct{}
 	Volumes  map[string]string
 	// Store rw/ro in a separate structure to preserve reverse-compatibility on-disk.
@@ -62,9 +89,16 @@ type Container struct {
 type Config struct {
 	Hostname        string
 	User            string
-	Memory          int64 // Memory limit (in bytes)
-	MemorySwap      int64 // Total memory usage (memory + swap); set `-1' to disable swap
-	CpuShares       int64 // CPU shares (relative weight vs. other containers)
+	Memory          int64  // Memory limit (in bytes)
+	MemorySwap      int64  // Total memory usage (memory + swap); set `-1' to disable swap
+	CpuShares       int64  // CPU shares (relative weight vs. other containers)
+	CpusetCpus      string // CPUs the processes can run on, e.g. 0-2,4
+	CpusetMems      string // Memory nodes the processes can allocate from
+	BlkioWeight     int64  // Block I/O weight (relative weight, 10 to 1000)
+	BlkioReadBps    []ThrottleDevice
+	BlkioWriteBps   []ThrottleDevice
+	PidsLimit       int64 // Maximum number of processes, 0 for no limit
+	Ulimits         []Ulimit
 	AttachStdin     bool
 	AttachStdout    bool
 	AttachStderr    bool
@@ -75,6 +109,7 @@ type Config struct {
 	Env             []string
 	Cmd             []string
 	Dns             []string
+	DnsSearch       []string
 	Image           string // Name of the image as it was passed by the operator (eg. could be symbolic)
 	Volumes         map[string]struct{}
 	VolumesFrom     string
@@ -82,12 +117,58 @@ type Config struct {
 	Entrypoint      []string
 	NetworkDisabled bool
 	Privileged      bool
+	CapAdd          []string
+	CapDrop         []string
+	Init            bool   // Run the program under dockerinit, which reaps zombies and forwards signals
+	StopSignal      string // Signal sent by Stop before SIGKILL, SIGTERM by default
+	Labels          map[string]string
+	Healthcheck     *HealthConfig
 }
 
 type HostConfig struct {
 	Binds           []string
 	ContainerIDFile string
 	LxcConf         []KeyValuePair
+	RestartPolicy   RestartPolicy
+	Links           []string
+	Devices         []DeviceMapping
+	ReadonlyRootfs  bool
+	Tmpfs           map[string]string
+}
+
+// RestartPolicy tells what to do when the process of a container exits:
+// nothing ("no"), restart it whatever its exit code ("always"), or restart
+// it when it fails ("on-failure"), at most MaximumRetryCount times when set.
+type RestartPolicy struct {
+	Name              string
+	MaximumRetryCount int
+}
+
+// DeviceMapping gives a container access to the device PathOnHost of the
+// host, at PathInContainer. CgroupPermissions is made of r (read), w (write)
+// and m (mknod).
+type DeviceMapping struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
+}
+
+// ThrottleDevice limits the rate of the I/O of a container on a block device.
+type ThrottleDevice struct {
+	Path string
+	Rate uint64 // in bytes per second
+}
+
+// Ulimit is a resource limit set with setrlimit(2) by dockerinit, such as
+// nofile or nproc.
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+func (ulimit Ulimit) String() string {
+	return fmt.Sprintf("%s=%d:%d", ulimit.Name, ulimit.Soft, ulimit.Hard)
 }
 
 type BindMap struct {
@@ -100,6 +181,17 @@ var (
 	ErrInvaidWorikingDirectory = errors.New("The working directory is invalid. It needs to be an absolute path.")
 )
 
+const (
+	// Delays between the restarts of a container which keeps on exiting
+	minRestartDelay = 100 * time.Millisecond
+	maxRestartDelay = time.Minute
+	// The delay is reset once a container stayed up for that long
+	restartResetTime = 10 * time.Second
+	// How long an exited container waits for the OOM notifications of its
+	// memory group to end
+	oomWaitTimeout = time.Second
+)
+
 type KeyValuePair struct {
 	Key   string
 	Value string
@@ -114,7 +206,7 @@ func ParseRun(args []string, capabilities *Capabilities) (*Config, *HostConfig,
 
 	flHostname := cmd.String("h", "", "Container host name")
 	flWorkingDir := cmd.String("w", "", "Working directory inside the container")
-	flUser := cmd.String("u", "", "Username or UID")
+	flUser := cmd.String("u", "", "Username or UID, with an optional group (user[:group])")
 	flDetach := cmd.Bool("d", false, "Detached mode: Run container in the background, print new container id")
 	flAttach := NewAttachOpts()
 	cmd.Var(flAttach, "a", "Attach to stdin, stdout or stderr.")
@@ -124,6 +216,12 @@ func ParseRun(args []string, capabilities *Capabilities) (*Config, *HostConfig,
 	flContainerIDFile := cmd.String("cidfile", "", "Write the container ID to the file")
 	flNetwork := cmd.Bool("n", true, "Enable networking for this container")
 	flPrivileged := cmd.Bool("privileged", false, "Give extended privileges to this container")
+	flInit := cmd.Bool("init", false, "Run an init inside the container that forwards signals and reaps processes")
+	flStopSignal := cmd.String("stop-signal", "", "Signal to stop the container with (default SIGTERM)")
+
+	var flLabels ListOpts
+	cmd.Var(&flLabels, "label", "Set metadata on the container (e.g. -label team=payments)")
+	cmd.String("name", "", "Assign a name to the container")
 
 	if capabilities != nil && *flMemory > 0 && !capabilities.MemoryLimit {
 		//fmt.Fprintf(stdout, "WARNING: Your kernel does not support memory limit capabilities. Limitation discarded.\n")
@@ -131,6 +229,25 @@ func ParseRun(args []string, capabilities *Capabilities) (*Config, *HostConfig,
 	}
 
 	flCpuShares := cmd.Int64("c", 0, "CPU shares (relative weight)")
+	flCpusetCpus := cmd.String("cpuset-cpus", "", "CPUs in which to allow execution (0-3, 0,1)")
+	flCpusetMems := cmd.String("cpuset-mems", "", "Memory nodes in which to allow execution (0-3, 0,1)")
+	flBlkioWeight := cmd.Int64("blkio-weight", 0, "Block IO weight (relative weight, between 10 and 1000)")
+	flPidsLimit := cmd.Int64("pids-limit", 0, "Maximum number of processes (0 for no limit)")
+
+	var flDeviceReadBps ListOpts
+	cmd.Var(&flDeviceReadBps, "device-read-bps", "Limit the read rate from a device in bytes per second (/dev/sda:1048576)")
+
+	var flDeviceWriteBps ListOpts
+	cmd.Var(&flDeviceWriteBps, "device-write-bps", "Limit the write rate to a device in bytes per second (/dev/sda:1048576)")
+
+	var flUlimits ListOpts
+	cmd.Var(&flUlimits, "ulimit", "Set a resource limit (nofile=1024:2048)")
+
+	var flCapAdd ListOpts
+	cmd.Var(&flCapAdd, "cap-add", "Add a Linux capability (NET_ADMIN, ALL)")
+
+	var flCapDrop ListOpts
+	cmd.Var(&flCapDrop, "cap-drop", "Drop a Linux capability (NET_RAW, ALL)")
 
 	var flPorts ListOpts
 	cmd.Var(&flPorts, "p", "Expose a container's port to the host (use 'docker port' to see the actual mapping)")
@@ -141,6 +258,9 @@ func ParseRun(args []string, capabilities *Capabilities) (*Config, *HostConfig,
 	var flDns ListOpts
 	cmd.Var(&flDns, "dns", "Set custom dns servers")
 
+	var flDnsSearch ListOpts
+	cmd.Var(&flDnsSearch, "dns-search", "Set custom dns search domains")
+
 	flVolumes := NewPathOpts()
 	cmd.Var(flVolumes, "v", "Bind mount a volume (e.g. from the host: -v /host:/container, from docker: -v /container)")
 
@@ -150,12 +270,38 @@ func ParseRun(args []string, capabilities *Capabilities) (*Config, *HostConfig,
 	var flLxcOpts ListOpts
 	cmd.Var(&flLxcOpts, "lxc-conf", "Add custom lxc options -lxc-conf=\"lxc.cgroup.cpuset.cpus = 0,1\"")
 
+	flRestart := cmd.String("restart", "", "Restart policy to apply when the container exits (no, on-failure[:max-retry], always)")
+
+	var flLinks ListOpts
+	cmd.Var(&flLinks, "link", "Add a link to another container (name:alias)")
+
+	var flDevices ListOpts
+	cmd.Var(&flDevices, "device", "Add a host device to the container (e.g. -device /dev/fuse:/dev/fuse:rwm)")
+
+	flReadonly := cmd.Bool("read-only", false, "Mount the root filesystem of the container read-only")
+	var flTmpfs ListOpts
+	cmd.Var(&flTmpfs, "tmpfs", "Mount a tmpfs directory (e.g. -tmpfs /run:size=64m,mode=755)")
+
+	flHealthCmd := cmd.String("health-cmd", "", "Command run to check the health of the container")
+	flHealthInterval := cmd.Int("health-interval", 0, "Seconds between two health checks (default 30)")
+	flHealthTimeout := cmd.Int("health-timeout", 0, "Seconds after which a health check fails (default 30)")
+	flHealthRetries := cmd.Int("health-retries", 0, "Consecutive failures needed to report unhealthy (default 3)")
+	flNoHealthcheck := cmd.Bool("no-healthcheck", false, "Disable the health check of the image")
+
 	if err := cmd.Parse(args); err != nil {
 		return nil, nil, cmd, err
 	}
 	if *flDetach && len(flAttach) > 0 {
 		return nil, nil, cmd, fmt.Errorf("Conflicting options: -a and -d")
 	}
+	if strings.Count(*flUser, ":") > 1 {
+		return nil, nil, cmd, fmt.Errorf("Invalid user: %s (expected user[:group])", *flUser)
+	}
+	if *flStopSignal != "" {
+		if _, err := parseSignal(*flStopSignal); err != nil {
+			return nil, nil, cmd, err
+		}
+	}
 	if *flWorkingDir != "" && !path.IsAbs(*flWorkingDir) {
 		return nil, nil, cmd, ErrInvaidWorikingDirectory
 	}
@@ -203,6 +349,79 @@ func ParseRun(args []string, capabilities *Capabilities) (*Config, *HostConfig,
 		return nil, nil, cmd, err
 	}
 
+	restartPolicy, err := parseRestartPolicy(*flRestart)
+	if err != nil {
+		return nil, nil, cmd, err
+	}
+
+	for _, link := range flLinks {
+		if _, _, err := parseLink(link); err != nil {
+			return nil, nil, cmd, err
+		}
+	}
+
+	var devices []DeviceMapping
+	for _, value := range flDevices {
+		device, err := parseDevice(value)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		devices = append(devices, device)
+	}
+	tmpfs := make(map[string]string)
+	for _, value := range flTmpfs {
+		tmpfsPath, options, err := parseTmpfs(value)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		tmpfs[tmpfsPath] = options
+	}
+
+	if *flBlkioWeight != 0 && (*flBlkioWeight < 10 || *flBlkioWeight > 1000) {
+		return nil, nil, cmd, fmt.Errorf("Invalid block IO weight: %d (expected between 10 and 1000)", *flBlkioWeight)
+	}
+	if *flPidsLimit < 0 {
+		return nil, nil, cmd, fmt.Errorf("Invalid pids limit: %d", *flPidsLimit)
+	}
+	var readBps, writeBps []ThrottleDevice
+	for _, value := range flDeviceReadBps {
+		device, err := parseThrottleDevice(value)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		readBps = append(readBps, device)
+	}
+	for _, value := range flDeviceWriteBps {
+		device, err := parseThrottleDevice(value)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		writeBps = append(writeBps, device)
+	}
+	var ulimits []Ulimit
+	for _, value := range flUlimits {
+		ulimit, err := parseUlimit(value)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		ulimits = append(ulimits, ulimit)
+	}
+
+	labels, err := parseLabels(flLabels)
+	if err != nil {
+		return nil, nil, cmd, err
+	}
+
+	capAdd, capDrop, err := parseCapabilities(flCapAdd, flCapDrop)
+	if err != nil {
+		return nil, nil, cmd, err
+	}
+
+	healthcheck, err := parseHealthcheck(*flHealthCmd, *flHealthInterval, *flHealthTimeout, *flHealthRetries, *flNoHealthcheck)
+	if err != nil {
+		return nil, nil, cmd, err
+	}
+
 	config := &Config{
 		Hostname:        *flHostname,
 		PortSpecs:       flPorts,
@@ -212,29 +431,51 @@ func ParseRun(args []string, capabilities *Capabilities) (*Config, *HostConfig,
 		OpenStdin:       *flStdin,
 		Memory:          *flMemory,
 		CpuShares:       *flCpuShares,
+		CpusetCpus:      *flCpusetCpus,
+		CpusetMems:      *flCpusetMems,
+		BlkioWeight:     *flBlkioWeight,
+		BlkioReadBps:    readBps,
+		BlkioWriteBps:   writeBps,
+		PidsLimit:       *flPidsLimit,
+		Ulimits:         ulimits,
 		AttachStdin:     flAttach.Get("stdin"),
 		AttachStdout:    flAttach.Get("stdout"),
 		AttachStderr:    flAttach.Get("stderr"),
 		Env:             flEnv,
 		Cmd:             runCmd,
 		Dns:             flDns,
+		DnsSearch:       flDnsSearch,
 		Image:           image,
 		Volumes:         flVolumes,
 		VolumesFrom:     *flVolumesFrom,
 		Entrypoint:      entrypoint,
 		Privileged:      *flPrivileged,
+		CapAdd:          capAdd,
+		CapDrop:         capDrop,
+		Init:            *flInit,
+		StopSignal:      *flStopSignal,
+		Labels:          labels,
 		WorkingDir:      *flWorkingDir,
+		Healthcheck:     healthcheck,
 	}
 	hostConfig := &HostConfig{
 		Binds:           binds,
 		ContainerIDFile: *flContainerIDFile,
 		LxcConf:         lxcConf,
+		RestartPolicy:   restartPolicy,
+		Links:           flLinks,
+		Devices:         devices,
+		ReadonlyRootfs:  *flReadonly,
+		Tmpfs:           tmpfs,
 	}
 
 	if capabilities != nil && *flMemory > 0 && !capabilities.SwapLimit {
 		//fmt.Fprintf(stdout, "WARNING: Your kernel does not support swap limit capabilities. Limitation discarded.\n")
 		config.MemorySwap = -1
 	}
+	if capabilities != nil {
+		discardUnsupportedLimits(config, capabilities)
+	}
 
 	// When allocating stdin in attached mode, close stdin at client disconnect
 	if config.OpenStdin && config.AttachStdin {
@@ -268,12 +509,15 @@ func (settings *NetworkSettings) PortMappingHuman() string {
 
 // Inject the io.Reader at the given path. Note: do not close the reader
 func (container *Container) Inject(file io.Reader, pth string) error {
+	if err := container.EnsureMounted(); err != nil {
+		return err
+	}
 	// Make sure the directory exists
-	if err := os.MkdirAll(path.Join(container.rwPath(), path.Dir(pth)), 0755); err != nil {
+	if err := os.MkdirAll(path.Join(container.RootfsPath(), path.Dir(pth)), 0755); err != nil {
 		return err
 	}
 	// FIXME: Handle permissions/already existing dest
-	dest, err := os.Create(path.Join(container.rwPath(), pth))
+	dest, err := os.Create(path.Join(container.RootfsPath(), pth))
 	if err != nil {
 		return err
 	}
@@ -304,6 +548,15 @@ func (container *Container) FromDisk() error {
 	return nil
 }
 
+// MarshalJSON encodes the container while the health check can't replace
+// its health.
+func (container *Container) MarshalJSON() ([]byte, error) {
+	type plainContainer Container
+	container.State.healthLock.Lock()
+	defer container.State.healthLock.Unlock()
+	return json.Marshal((*plainContainer)(container))
+}
+
 func (container *Container) ToDisk() (err error) {
 	data, err := json.Marshal(container)
 	if err != nil {
@@ -332,23 +585,6 @@ func (container *Container) SaveHostConfig(hostConfig *HostConfig) (err error) {
 	return ioutil.WriteFile(container.hostConfigPath(), data, 0666)
 }
 
-func (container *Container) generateLXCConfig(hostConfig *HostConfig) error {
-	fo, err := os.Create(container.lxcConfigPath())
-	if err != nil {
-		return err
-	}
-	defer fo.Close()
-	if err := LxcTemplateCompiled.Execute(fo, container); err != nil {
-		return err
-	}
-	if hostConfig != nil {
-		if err := LxcHostConfigTemplateCompiled.Execute(fo, hostConfig); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func (container *Container) startPty() error {
 	ptyMaster, ptySlave, err := pty.Open()
 	if err != nil {
@@ -369,7 +605,11 @@ func (container *Container) startPty() error {
 	// stdin
 	if container.Config.OpenStdin {
 		container.cmd.Stdin = ptySlave
-		container.cmd.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true}
+		if container.cmd.SysProcAttr == nil {
+			container.cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		container.cmd.SysProcAttr.Setctty = true
+		container.cmd.SysProcAttr.Setsid = true
 		go func() {
 			defer container.stdin.Close()
 			utils.Debugf("[startPty] Begin of stdin pipe")
@@ -377,29 +617,122 @@ func (container *Container) startPty() error {
 			utils.Debugf("[startPty] End of stdin pipe")
 		}()
 	}
-	if err := container.cmd.Start(); err != nil {
+	if err := container.runtime.execDriver.Run(container, container.cmd); err != nil {
 		return err
 	}
 	ptySlave.Close()
 	return nil
 }
 
+// Without a tty, the standard streams of the process go through FIFOs in the
+// root of the container rather than pipes, so that a new daemon can open them
+// again and adopt the containers left running by the previous one.
 func (container *Container) start() error {
-	container.cmd.Stdout = container.stdout
-	container.cmd.Stderr = container.stderr
+	streams := []string{"stdout", "stderr"}
 	if container.Config.OpenStdin {
-		stdin, err := container.cmd.StdinPipe()
+		streams = append(streams, "stdin")
+	}
+	for _, stream := range streams {
+		os.Remove(container.fifoPath(stream))
+		if err := syscall.Mkfifo(container.fifoPath(stream), 0600); err != nil {
+			return err
+		}
+	}
+
+	// The process opens its outputs for reading too: they would be broken
+	// pipes otherwise as soon as the daemon is gone.
+	stdout, err := os.OpenFile(container.fifoPath("stdout"), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.OpenFile(container.fifoPath("stderr"), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+	container.cmd.Stdout = stdout
+	container.cmd.Stderr = stderr
+
+	if err := container.openFifos(); err != nil {
+		return err
+	}
+
+	if container.Config.OpenStdin {
+		// Closing stdin must reach the process: it gets EOF when the daemon
+		// is gone too.
+		stdin, err := os.OpenFile(container.fifoPath("stdin"), os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer stdin.Close()
+		container.cmd.Stdin = stdin
+	}
+	return container.runtime.execDriver.Run(container, container.cmd)
+}
+
+// openFifos opens the daemon ends of the FIFOs of the container, and copies
+// them from and to its streams until the process exits.
+func (container *Container) openFifos() error {
+	container.fifos = nil
+	outputs := map[string]*utils.WriteBroadcaster{"stdout": container.stdout, "stderr": container.stderr}
+	for stream, dst := range outputs {
+		// Don't block if the process is gone already: reading reaches EOF
+		fifo, err := os.OpenFile(container.fifoPath(stream), os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			return err
+		}
+		container.fifos = append(container.fifos, fifo)
+		container.streams.Add(1)
+		go func(stream string, fifo *os.File, dst *utils.WriteBroadcaster) {
+			defer container.streams.Done()
+			defer fifo.Close()
+			utils.Debugf("Begin of %s pipe [start]", stream)
+			io.Copy(dst, fifo)
+			utils.Debugf("End of %s pipe [start]", stream)
+		}(stream, fifo, dst)
+	}
+	if container.Config.OpenStdin {
+		// Opening it read-write doesn't wait for the process to open it
+		fifo, err := os.OpenFile(container.fifoPath("stdin"), os.O_RDWR, 0)
 		if err != nil {
 			return err
 		}
+		container.fifos = append(container.fifos, fifo)
+		// monitor replaces container.stdin once the process exited
+		stdin := container.stdin
 		go func() {
-			defer stdin.Close()
+			defer fifo.Close()
 			utils.Debugf("Begin of stdin pipe [start]")
-			io.Copy(stdin, container.stdin)
+			io.Copy(fifo, stdin)
 			utils.Debugf("End of stdin pipe [start]")
 		}()
 	}
-	return container.cmd.Start()
+	return nil
+}
+
+// restore adopts the process of a container left running by a previous
+// daemon. Containers with a tty lost it along with that daemon, and the ones
+// started by older daemons have no FIFOs: those can't be attached to.
+func (container *Container) restore() error {
+	if err := container.restoreNetwork(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(container.fifoPath("stdout")); err != nil || container.Config.Tty {
+		container.State.Ghost = true
+		return nil
+	}
+	if err := container.runtime.LogToDisk(container.stdout, container.logPath("json"), "stdout"); err != nil {
+		return err
+	}
+	if err := container.runtime.LogToDisk(container.stderr, container.logPath("json"), "stderr"); err != nil {
+		return err
+	}
+	if err := container.openFifos(); err != nil {
+		return err
+	}
+	container.State.Ghost = false
+	return nil
 }
 
 func (container *Container) Attach(stdin io.ReadCloser, stdinCloser io.Closer, stdout io.Writer, stderr io.Writer) chan error {
@@ -542,16 +875,34 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 	container.State.Lock()
 	defer container.State.Unlock()
 
-	if len(hostConfig.Binds) == 0 && len(hostConfig.LxcConf) == 0 {
-		hostConfig, _ = container.ReadHostConfig()
-	}
-
 	if container.State.Running {
 		return fmt.Errorf("The container %s is already running.", container.ID)
 	}
+	// Starting the container by hand resets its restart policy
+	container.manualStop = false
+	container.restartDelay = 0
+	container.State.RestartCount = 0
+	return container.startLocked(hostConfig)
+}
+
+// startLocked starts the process of the container, which state must be
+// locked and not running.
+func (container *Container) startLocked(hostConfig *HostConfig) error {
+	if len(hostConfig.Binds) == 0 && len(hostConfig.LxcConf) == 0 && hostConfig.RestartPolicy.Name == "" && len(hostConfig.Links) == 0 &&
+		len(hostConfig.Devices) == 0 && !hostConfig.ReadonlyRootfs && len(hostConfig.Tmpfs) == 0 {
+		hostConfig, _ = container.ReadHostConfig()
+	}
+	if _, err := parseRestartPolicy(hostConfig.RestartPolicy.Name); err != nil {
+		return err
+	}
+
 	if err := container.EnsureMounted(); err != nil {
 		return err
 	}
+	links, err := container.setupLinks(hostConfig.Links)
+	if err != nil {
+		return err
+	}
 	if container.runtime.networkManager.disabled {
 		container.Config.NetworkDisabled = true
 	} else {
@@ -559,6 +910,16 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 			return err
 		}
 	}
+	// Generated on each start, as the address and the links may change
+	if err := container.setupDns(links); err != nil {
+		return err
+	}
+	for tmpfsPath := range hostConfig.Tmpfs {
+		if err := os.MkdirAll(path.Join(container.RootfsPath(), tmpfsPath), 0755); err != nil {
+			return err
+		}
+	}
+	container.hostConfig = hostConfig
 
 	// Make sure the config is compatible with the current kernel
 	if container.Config.Memory > 0 && !container.runtime.capabilities.MemoryLimit {
@@ -570,6 +931,18 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 		container.Config.MemorySwap = -1
 	}
 
+	for _, warning := range discardUnsupportedLimits(container.Config, container.runtime.capabilities) {
+		log.Printf("WARNING: %s\n", warning)
+	}
+	// The devices must exist on this host
+	for _, devices := range [][]ThrottleDevice{container.Config.BlkioReadBps, container.Config.BlkioWriteBps} {
+		for _, device := range devices {
+			if _, err := deviceNumbers(device.Path); err != nil {
+				return err
+			}
+		}
+	}
+
 	if container.runtime.capabilities.IPv4ForwardingDisabled {
 		log.Printf("WARNING: IPv4 forwarding is disabled. Networking will not work")
 	}
@@ -667,16 +1040,8 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 		}
 	}
 
-	if err := container.generateLXCConfig(hostConfig); err != nil {
-		return err
-	}
-
-	params := []string{
-		"-n", container.ID,
-		"-f", container.lxcConfigPath(),
-		"--",
-		"/.dockerinit",
-	}
+	// Arguments passed to dockerinit
+	params := []string{}
 
 	// Networking
 	if !container.Config.NetworkDisabled {
@@ -688,17 +1053,28 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 		params = append(params, "-u", container.Config.User)
 	}
 
-	if container.Config.Tty {
-		params = append(params, "-e", "TERM=xterm")
+	// Init
+	if container.Config.Init {
+		params = append(params, "-init")
+	}
+
+	// Without a tty, a new daemon can adopt the container: it then needs
+	// dockerinit to tell it the exit status of the program
+	if !container.Config.Tty {
+		if err := ioutil.WriteFile(container.ExitStatusPath(), nil, 0600); err != nil {
+			return err
+		}
+		params = append(params, "-exitstatus")
+	}
+
+	// Resource limits
+	for _, ulimit := range container.Config.Ulimits {
+		params = append(params, "-ulimit", ulimit.String())
 	}
 
 	// Setup environment
-	params = append(params,
-		"-e", "HOME=/",
-		"-e", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
-		"-e", "container=lxc",
-		"-e", "HOSTNAME="+container.Config.Hostname,
-	)
+	params = append(params, container.environment(container.Config.Tty)...)
+
 	if container.Config.WorkingDir != "" {
 		workingDir := path.Clean(container.Config.WorkingDir)
 		utils.Debugf("[working dir] working dir is %s", workingDir)
@@ -712,15 +1088,15 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 		)
 	}
 
-	for _, elem := range container.Config.Env {
-		params = append(params, "-e", elem)
-	}
-
 	// Program
 	params = append(params, "--", container.Path)
 	params = append(params, container.Args...)
 
-	container.cmd = exec.Command("lxc-start", params...)
+	cmd, err := container.runtime.execDriver.Command(container, hostConfig, params)
+	if err != nil {
+		return err
+	}
+	container.cmd = cmd
 
 	// Setup logging of stdout and stderr to disk
 	if err := container.runtime.LogToDisk(container.stdout, container.logPath("json"), "stdout"); err != nil {
@@ -730,7 +1106,6 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 		return err
 	}
 
-	var err error
 	if container.Config.Tty {
 		err = container.startPty()
 	} else {
@@ -748,6 +1123,9 @@ func (container *Container) Start(hostConfig *HostConfig) error {
 
 	container.ToDisk()
 	container.SaveHostConfig(hostConfig)
+	container.runtime.updateLinks(container)
+	container.startHealthcheck()
+	container.watchOOM()
 	go container.monitor()
 	return nil
 }
@@ -800,40 +1178,35 @@ func (container *Container) allocateNetwork() error {
 		return nil
 	}
 
-	var iface *NetworkInterface
-	var err error
-	if !container.State.Ghost {
-		iface, err = container.runtime.networkManager.Allocate()
-		if err != nil {
-			return err
-		}
-	} else {
-		manager := container.runtime.networkManager
-		if manager.disabled {
-			iface = &NetworkInterface{disabled: true}
-		} else {
-			iface = &NetworkInterface{
-				IPNet: net.IPNet{IP: net.ParseIP(container.NetworkSettings.IPAddress), Mask: manager.bridgeNetwork.Mask},
-				Gateway: manager.bridgeNetwork.IP,
-				manager: manager,
-				}
-			ipNum := ipToInt(iface.IPNet.IP)
-			manager.ipAllocator.inUse[ipNum] = struct{}{}
-		}
+	iface, err := container.runtime.networkManager.Allocate()
+	if err != nil {
+		return err
+	}
+	return container.setupNetwork(iface, container.Config.PortSpecs)
+}
+
+// restoreNetwork reserves the address and ports allocated to a container
+// by a previous daemon, and maps its ports again.
+func (container *Container) restoreNetwork() error {
+	if container.Config.NetworkDisabled {
+		return nil
 	}
 
+	iface, err := container.runtime.networkManager.Restore(net.ParseIP(container.NetworkSettings.IPAddress))
+	if err != nil {
+		return err
+	}
 	var portSpecs []string
-	if !container.State.Ghost {
-		portSpecs = container.Config.PortSpecs
-	} else {
-		for backend, frontend := range container.NetworkSettings.PortMapping["Tcp"] {
-			portSpecs = append(portSpecs, fmt.Sprintf("%s:%s/tcp",frontend, backend))
-		}
-		for backend, frontend := range container.NetworkSettings.PortMapping["Udp"] {
-			portSpecs = append(portSpecs, fmt.Sprintf("%s:%s/udp",frontend, backend))
-		}
+	for backend, frontend := range container.NetworkSettings.PortMapping["Tcp"] {
+		portSpecs = append(portSpecs, fmt.Sprintf("%s:%s/tcp", frontend, backend))
+	}
+	for backend, frontend := range container.NetworkSettings.PortMapping["Udp"] {
+		portSpecs = append(portSpecs, fmt.Sprintf("%s:%s/udp", frontend, backend))
 	}
+	return container.setupNetwork(iface, portSpecs)
+}
 
+func (container *Container) setupNetwork(iface *NetworkInterface, portSpecs []string) error {
 	container.NetworkSettings.PortMapping = make(map[string]PortMapping)
 	container.NetworkSettings.PortMapping["Tcp"] = make(PortMapping)
 	container.NetworkSettings.PortMapping["Udp"] = make(PortMapping)
@@ -865,13 +1238,13 @@ func (container *Container) releaseNetwork() {
 }
 
 // FIXME: replace this with a control socket within docker-init
-func (container *Container) waitLxc() error {
+func (container *Container) waitExecDriver() error {
 	for {
-		output, err := exec.Command("lxc-info", "-n", container.ID).CombinedOutput()
+		info, err := container.runtime.execDriver.Info(container)
 		if err != nil {
 			return err
 		}
-		if !strings.Contains(string(output), "RUNNING") {
+		if !info.Running {
 			return nil
 		}
 		time.Sleep(500 * time.Millisecond)
@@ -882,9 +1255,9 @@ func (container *Container) monitor() {
 	// Wait for the program to exit
 	utils.Debugf("Waiting for process")
 
-	// If the command does not exists, try to wait via lxc
+	// If the command does not exists, try to wait via the execution driver
 	if container.cmd == nil {
-		if err := container.waitLxc(); err != nil {
+		if err := container.waitExecDriver(); err != nil {
 			utils.Debugf("%s: Process: %s", container.ID, err)
 		}
 	} else {
@@ -894,14 +1267,27 @@ func (container *Container) monitor() {
 		}
 	}
 	utils.Debugf("Process finished")
+	container.stopHealthcheck()
+	if container.runtime != nil {
+		if err := container.runtime.execDriver.Terminate(container); err != nil {
+			utils.Debugf("%s: Error terminating container: %s", container.ID, err)
+		}
+	}
 	if container.runtime != nil && container.runtime.srv != nil {
 		container.runtime.srv.LogEvent("die", container.ShortID(), container.runtime.repositories.ImageName(container.Image))
 	}
+	// Only the parent of the process can wait for it: a process adopted
+	// from a previous daemon left its exit status to dockerinit
 	exitCode := -1
 	if container.cmd != nil {
 		exitCode = container.cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+	} else if status, err := container.readExitStatus(); err == nil {
+		exitCode = status
 	}
 
+	// Wait for the output of the process to be copied
+	container.streams.Wait()
+
 	// Cleanup
 	container.releaseNetwork()
 	if container.Config.OpenStdin {
@@ -933,18 +1319,157 @@ func (container *Container) monitor() {
 
 	// Report status back
 	container.State.setStopped(exitCode)
+	container.State.OOMKilled = container.waitOOM()
+
+	// Before releasing the lock: whoever waits for the container may remove
+	// its root as soon as Wait returns.
+	// FIXME: why are we serializing running state to disk in the first place?
+	if err := container.ToDisk(); err != nil {
+		utils.Debugf("%s: Failed to dump configuration to the disk: %s", container.ID, err)
+	}
 
 	// Release the lock
 	close(container.waitLock)
 
+	// Stop and Kill keep the state locked until the process is gone, which
+	// closing waitLock tells them. They keep it from restarting too.
+	container.State.Lock()
+	defer container.State.Unlock()
+	if !container.shouldRestart() {
+		return
+	}
+	container.State.Restarting = true
+	delay := container.nextRestartDelay()
 	if err := container.ToDisk(); err != nil {
-		// FIXME: there is a race condition here which causes this to fail during the unit tests.
-		// If another goroutine was waiting for Wait() to return before removing the container's root
-		// from the filesystem... At this point it may already have done so.
-		// This is because State.setStopped() has already been called, and has caused Wait()
-		// to return.
-		// FIXME: why are we serializing running state to disk in the first place?
-		//log.Printf("%s: Failed to dump configuration to the disk: %s", container.ID, err)
+		utils.Debugf("%s: Failed to dump configuration to the disk: %s", container.ID, err)
+	}
+	go container.restartAfterBackoff(delay)
+}
+
+// watchOOM records the OOM kills in the memory control group of the
+// container, so that they can be told apart from docker kill once its
+// process exits.
+func (container *Container) watchOOM() {
+	container.oomLock.Lock()
+	container.oomKilled = false
+	container.oomDone = nil
+	container.oomLock.Unlock()
+	info, err := container.runtime.execDriver.Info(container)
+	if err != nil || info.Pid == 0 {
+		utils.Debugf("%s: Not watching OOM kills: no process", container.ID)
+		return
+	}
+	dir, err := processCgroupPath("memory", info.Pid)
+	// Without a group of its own, the OOM kills would not be the container's
+	if err != nil || !strings.Contains(dir, container.ID) {
+		utils.Debugf("%s: Not watching OOM kills: no memory cgroup", container.ID)
+		return
+	}
+	oom, err := notifyOOM(dir)
+	if err != nil {
+		utils.Debugf("%s: Not watching OOM kills: %s", container.ID, err)
+		return
+	}
+	container.recordOOM(oom)
+}
+
+// recordOOM records the OOM kills received from oom until it is closed.
+func (container *Container) recordOOM(oom <-chan struct{}) {
+	done := make(chan struct{})
+	container.oomLock.Lock()
+	container.oomDone = done
+	container.oomLock.Unlock()
+	go func() {
+		defer close(done)
+		for _ = range oom {
+			container.oomLock.Lock()
+			container.oomKilled = true
+			container.oomLock.Unlock()
+			if container.runtime != nil && container.runtime.srv != nil {
+				container.runtime.srv.LogEvent("oom", container.ShortID(), container.runtime.repositories.ImageName(container.Image))
+			}
+		}
+	}()
+}
+
+// waitOOM tells whether a process of the container was OOM killed. The
+// notification usually comes after the process is reaped: it waits for
+// the notifications to end, as they do once the memory group is removed,
+// or for oomWaitTimeout.
+func (container *Container) waitOOM() bool {
+	container.oomLock.Lock()
+	done := container.oomDone
+	container.oomLock.Unlock()
+	if done != nil {
+		select {
+		case <-done:
+		case <-time.After(oomWaitTimeout):
+			utils.Debugf("%s: Timeout waiting for the OOM notifications", container.ID)
+		}
+	}
+	container.oomLock.Lock()
+	defer container.oomLock.Unlock()
+	return container.oomKilled
+}
+
+// shouldRestart tells whether the restart policy of the container asks for
+// it to be started again, now that its process exited. The state must be
+// locked.
+func (container *Container) shouldRestart() bool {
+	if container.runtime == nil || container.manualStop {
+		return false
+	}
+	hostConfig, err := container.ReadHostConfig()
+	if err != nil {
+		return false
+	}
+	policy := hostConfig.RestartPolicy
+	switch policy.Name {
+	case "always":
+		return true
+	case "on-failure":
+		if container.State.ExitCode == 0 {
+			return false
+		}
+		return policy.MaximumRetryCount == 0 || container.State.RestartCount < policy.MaximumRetryCount
+	}
+	return false
+}
+
+// nextRestartDelay returns how long to wait before the next restart of the
+// container, which state must be locked. The delay doubles with every
+// restart, and is reset once the container stayed up long enough.
+func (container *Container) nextRestartDelay() time.Duration {
+	if time.Now().Sub(container.State.StartedAt) >= restartResetTime {
+		container.restartDelay = 0
+	}
+	if container.restartDelay == 0 {
+		container.restartDelay = minRestartDelay
+	} else if container.restartDelay *= 2; container.restartDelay > maxRestartDelay {
+		container.restartDelay = maxRestartDelay
+	}
+	return container.restartDelay
+}
+
+// restartAfterBackoff starts the container again after delay, unless it was
+// stopped or started by hand in the meantime.
+func (container *Container) restartAfterBackoff(delay time.Duration) {
+	time.Sleep(delay)
+
+	container.State.Lock()
+	defer container.State.Unlock()
+	if !container.State.Restarting {
+		return
+	}
+	container.State.RestartCount++
+	if err := container.startLocked(&HostConfig{}); err != nil {
+		log.Printf("%s: Failed to restart: %s", container.ID, err)
+		container.State.Restarting = false
+		container.ToDisk()
+		return
+	}
+	if container.runtime.srv != nil {
+		container.runtime.srv.LogEvent("restart", container.ShortID(), container.runtime.repositories.ImageName(container.Image))
 	}
 }
 
@@ -953,18 +1478,17 @@ func (container *Container) kill() error {
 		return nil
 	}
 
-	// Sending SIGKILL to the process via lxc
-	output, err := exec.Command("lxc-kill", "-n", container.ID, "9").CombinedOutput()
-	if err != nil {
-		log.Printf("error killing container %s (%s, %s)", container.ID, output, err)
+	// Sending SIGKILL to the process via the execution driver
+	if err := container.runtime.execDriver.Kill(container, 9); err != nil {
+		log.Printf("error killing container %s (%s)", container.ID, err)
 	}
 
 	// 2. Wait for the process to die, in last resort, try to kill the process directly
 	if err := container.WaitTimeout(10 * time.Second); err != nil {
 		if container.cmd == nil {
-			return fmt.Errorf("lxc-kill failed, impossible to kill the container %s", container.ID)
+			return fmt.Errorf("%s kill failed, impossible to kill the container %s", container.runtime.execDriver.Name(), container.ID)
 		}
-		log.Printf("Container %s failed to exit within 10 seconds of lxc SIGKILL - trying direct SIGKILL", container.ID)
+		log.Printf("Container %s failed to exit within 10 seconds of %s SIGKILL - trying direct SIGKILL", container.ID, container.runtime.execDriver.Name())
 		if err := container.cmd.Process.Kill(); err != nil {
 			return err
 		}
@@ -975,26 +1499,103 @@ func (container *Container) kill() error {
 	return nil
 }
 
+// Pause freezes the processes of the container, which stay in memory until
+// Unpause is called.
+func (container *Container) Pause() error {
+	container.State.Lock()
+	defer container.State.Unlock()
+	if !container.State.Running {
+		return fmt.Errorf("Impossible to pause container %s: it is not running", container.ID)
+	}
+	if container.State.Paused {
+		return fmt.Errorf("Impossible to pause container %s: it is already paused", container.ID)
+	}
+	if err := container.runtime.execDriver.Pause(container); err != nil {
+		return err
+	}
+	container.State.Paused = true
+	return container.ToDisk()
+}
+
+func (container *Container) Unpause() error {
+	container.State.Lock()
+	defer container.State.Unlock()
+	if !container.State.Running || !container.State.Paused {
+		return fmt.Errorf("Impossible to unpause container %s: it is not paused", container.ID)
+	}
+	return container.unpause()
+}
+
+func (container *Container) unpause() error {
+	if !container.State.Paused {
+		return nil
+	}
+	if err := container.runtime.execDriver.Unpause(container); err != nil {
+		return err
+	}
+	container.State.Paused = false
+	return container.ToDisk()
+}
+
+// preventRestart keeps the restart policy of the container from applying
+// until it is started again by hand.
+func (container *Container) preventRestart() {
+	container.manualStop = true
+	if container.State.Restarting {
+		container.State.Restarting = false
+		container.ToDisk()
+	}
+}
+
 func (container *Container) Kill() error {
 	container.State.Lock()
 	defer container.State.Unlock()
+	container.preventRestart()
 	if !container.State.Running {
 		return nil
 	}
+	// Frozen processes would not even die
+	if err := container.unpause(); err != nil {
+		return err
+	}
 	return container.kill()
 }
 
+// Signal sends sig to the container. Unlike Kill, it neither waits for the
+// container to exit nor prevents its restart.
+func (container *Container) Signal(sig int) error {
+	container.State.Lock()
+	defer container.State.Unlock()
+	if !container.State.Running {
+		return fmt.Errorf("Impossible to signal container %s: it is not running", container.ID)
+	}
+	return container.runtime.execDriver.Kill(container, sig)
+}
+
+// stopSignal returns the signal Stop sends first.
+func (container *Container) stopSignal() int {
+	if sig, err := parseSignal(container.Config.StopSignal); err == nil {
+		return sig
+	}
+	return 15
+}
+
 func (container *Container) Stop(seconds int) error {
 	container.State.Lock()
 	defer container.State.Unlock()
+	container.preventRestart()
 	if !container.State.Running {
 		return nil
 	}
+	if err := container.unpause(); err != nil {
+		return err
+	}
 
-	// 1. Send a SIGTERM
-	if output, err := exec.Command("lxc-kill", "-n", container.ID, "15").CombinedOutput(); err != nil {
-		log.Print(string(output))
-		log.Print("Failed to send SIGTERM to the process, force killing")
+	// 1. Send the stop signal, SIGTERM by default
+	sig := container.stopSignal()
+	if err := container.runtime.execDriver.Kill(container, sig); err != nil {
+		log.Print(err)
+		log.Printf("Failed to send signal %d to the process, force killing", sig)
 		if err := container.kill(); err != nil {
 			return err
 		}
@@ -1002,7 +1603,7 @@ func (container *Container) Stop(seconds int) error {
 
 	// 2. Wait for the process to exit on its own
 	if err := container.WaitTimeout(time.Duration(seconds) * time.Second); err != nil {
-		log.Printf("Container %v failed to exit within %d seconds of SIGTERM - using the force", container.ID, seconds)
+		log.Printf("Container %v failed to exit within %d seconds of signal %d - using the force", container.ID, seconds, sig)
 		if err := container.kill(); err != nil {
 			return err
 		}
@@ -1027,6 +1628,28 @@ func (container *Container) Wait() int {
 	return container.State.ExitCode
 }
 
+// environment returns the dockerinit arguments setting up the environment of
+// the processes run in the container.
+func (container *Container) environment(tty bool) []string {
+	params := []string{}
+	if tty {
+		params = append(params, "-e", "TERM=xterm")
+	}
+	params = append(params,
+		"-e", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"-e", "container="+container.runtime.execDriver.Name(),
+		"-e", "HOSTNAME="+container.Config.Hostname,
+	)
+	// The links come first, so that they can be overridden
+	for _, elem := range container.linkEnv {
+		params = append(params, "-e", elem)
+	}
+	for _, elem := range container.Config.Env {
+		params = append(params, "-e", elem)
+	}
+	return params
+}
+
 func (container *Container) Resize(h, w int) error {
 	pty, ok := container.ptyMaster.(*os.File)
 	if !ok {
@@ -1036,7 +1659,11 @@ func (container *Container) Resize(h, w int) error {
 }
 
 func (container *Container) ExportRw() (Archive, error) {
-	return Tar(container.rwPath(), Uncompressed)
+	image, err := container.GetImage()
+	if err != nil {
+		return nil, err
+	}
+	return image.Diff(container.RootfsPath(), container.rwPath())
 }
 
 func (container *Container) RwChecksum() (string, error) {
@@ -1091,7 +1718,7 @@ func (container *Container) Changes() ([]Change, error) {
 	if err != nil {
 		return nil, err
 	}
-	return image.Changes(container.rwPath())
+	return image.Changes(container.RootfsPath(), container.rwPath())
 }
 
 func (container *Container) GetImage() (*Image, error) {
@@ -1102,11 +1729,19 @@ func (container *Container) GetImage() (*Image, error) {
 }
 
 func (container *Container) Mounted() (bool, error) {
-	return Mounted(container.RootfsPath())
+	image, err := container.GetImage()
+	if err != nil {
+		return false, err
+	}
+	return image.Mounted(container.RootfsPath())
 }
 
 func (container *Container) Unmount() error {
-	return Unmount(container.RootfsPath())
+	image, err := container.GetImage()
+	if err != nil {
+		return err
+	}
+	return image.Unmount(container.RootfsPath(), container.rwPath())
 }
 
 // ShortID returns a shorthand version of the container's id for convenience.
@@ -1117,6 +1752,27 @@ func (container *Container) ShortID() string {
 	return utils.TruncateID(container.ID)
 }
 
+func (container *Container) fifoPath(stream string) string {
+	return path.Join(container.root, stream+".fifo")
+}
+
+// ExitStatusPath is where dockerinit records the exit status of the
+// program, for a new daemon to know it once it adopted the container.
+// This method must be exported to be used from the lxc template
+func (container *Container) ExitStatusPath() string {
+	return path.Join(container.root, "exitstatus")
+}
+
+// readExitStatus returns the exit status recorded by dockerinit, if the
+// program exited.
+func (container *Container) readExitStatus() (int, error) {
+	data, err := ioutil.ReadFile(container.ExitStatusPath())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
 func (container *Container) logPath(name string) string {
 	return path.Join(container.root, fmt.Sprintf("%s-%s.log", container.ID, name))
 }
@@ -1133,10 +1789,6 @@ func (container *Container) jsonPath() string {
 	return path.Join(container.root, "config.json")
 }
 
-func (container *Container) lxcConfigPath() string {
-	return path.Join(container.root, "config.lxc")
-}
-
 // This method must be exported to be used from the lxc template
 func (container *Container) RootfsPath() string {
 	return path.Join(container.root, "rootfs")
@@ -1157,12 +1809,11 @@ func validateID(id string) error {
 func (container *Container) GetSize() (int64, int64) {
 	var sizeRw, sizeRootfs int64
 
-	filepath.Walk(container.rwPath(), func(path string, fileInfo os.FileInfo, err error) error {
-		if fileInfo != nil {
-			sizeRw += fileInfo.Size()
-		}
-		return nil
-	})
+	if image, err := container.GetImage(); err != nil {
+		utils.Debugf("Error getting the image of container %s: %s", container.ID, err)
+	} else if sizeRw, err = image.ChangesSize(container.RootfsPath(), container.rwPath()); err != nil {
+		utils.Debugf("Error getting the size of the changes of container %s: %s", container.ID, err)
+	}
 
 	_, err := os.Stat(container.RootfsPath())
 	if err == nil {
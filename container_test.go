@@ -2,6 +2,7 @@ package docker
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -22,7 +23,7 @@ func TestIDFormat(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"/bin/sh", "-c", "echo hello world"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -132,6 +133,9 @@ func TestMultipleAttachRestart(t *testing.T) {
 }
 
 func TestDiff(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 	// Create a container and remove a file
@@ -211,6 +215,9 @@ func TestDiff(t *testing.T) {
 }
 
 func TestCommitAutoRun(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 	container1, _, _ := mkContainer(runtime, []string{"_", "/bin/sh", "-c", "echo hello > /world"}, t)
@@ -270,6 +277,9 @@ func TestCommitAutoRun(t *testing.T) {
 }
 
 func TestCommitRun(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -383,7 +393,7 @@ func TestOutput(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"echo", "-n", "foobar"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -407,7 +417,7 @@ func TestKillDifferentUser(t *testing.T) {
 		Cmd:       []string{"cat"},
 		OpenStdin: true,
 		User:      "daemon",
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -462,7 +472,7 @@ func TestCreateVolume(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	c, err := NewBuilder(runtime).Create(config)
+	c, err := NewBuilder(runtime).Create(config, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -480,7 +490,7 @@ func TestKill(t *testing.T) {
 	container, err := NewBuilder(runtime).Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"sleep", "2"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -517,6 +527,41 @@ func TestKill(t *testing.T) {
 	}
 }
 
+func TestStopSignal(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+	container, err := NewBuilder(runtime).Create(&Config{
+		Image:      GetTestImage(runtime).ID,
+		Cmd:        []string{"sh", "-c", "trap 'exit 3' INT; trap 'exit 4' HUP; while true; do sleep 0.1; done"},
+		StopSignal: "SIGINT",
+	}, "",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container)
+
+	if err := container.Start(&HostConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	// Give some time to the shell to set up its traps
+	container.WaitTimeout(500 * time.Millisecond)
+
+	// Any signal can be sent, without stopping the container
+	if err := container.Signal(signalNumbers["WINCH"]); err != nil {
+		t.Fatal(err)
+	}
+	if container.WaitTimeout(200*time.Millisecond) == nil {
+		t.Fatalf("The container should still be running")
+	}
+	if err := container.Stop(10); err != nil {
+		t.Fatal(err)
+	}
+	if container.State.ExitCode != 3 {
+		t.Fatalf("Expected the container to exit with 3 on SIGINT, found %d", container.State.ExitCode)
+	}
+}
+
 func TestExitCode(t *testing.T) {
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
@@ -526,7 +571,7 @@ func TestExitCode(t *testing.T) {
 	trueContainer, err := builder.Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"/bin/true", ""},
-	})
+	}, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -541,7 +586,7 @@ func TestExitCode(t *testing.T) {
 	falseContainer, err := builder.Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"/bin/false", ""},
-	})
+	}, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -554,13 +599,102 @@ func TestExitCode(t *testing.T) {
 	}
 }
 
+// The OOM notification can arrive after the process is reaped
+func TestWaitOOM(t *testing.T) {
+	container := &Container{ID: "oomtest"}
+	if container.waitOOM() {
+		t.Fatalf("A container without OOM notifications should not be OOM killed")
+	}
+
+	oom := make(chan struct{})
+	container.recordOOM(oom)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		oom <- struct{}{}
+		close(oom)
+	}()
+	setTimeout(t, "Waiting for the OOM notifications timed out", 2*time.Second, func() {
+		if !container.waitOOM() {
+			t.Errorf("The late OOM notification should have been recorded")
+		}
+	})
+}
+
+func TestRestartPolicy(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+
+	builder := NewBuilder(runtime)
+
+	// on-failure restarts a failing container at most MaximumRetryCount times
+	falseContainer, err := builder.Create(&Config{
+		Image: GetTestImage(runtime).ID,
+		Cmd:   []string{"/bin/false", ""},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(falseContainer)
+	if err := falseContainer.Start(&HostConfig{RestartPolicy: RestartPolicy{Name: "on-failure", MaximumRetryCount: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	setTimeout(t, "The container was not restarted twice", 5*time.Second, func() {
+		for falseContainer.State.RestartCount < 2 || falseContainer.State.Running || falseContainer.State.Restarting {
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	time.Sleep(500 * time.Millisecond)
+	if falseContainer.State.RestartCount != 2 || falseContainer.State.Running {
+		t.Fatalf("The container should have been restarted twice only, found %d restarts", falseContainer.State.RestartCount)
+	}
+	if falseContainer.State.ExitCode != 1 {
+		t.Errorf("Unexpected exit code %d (expected 1)", falseContainer.State.ExitCode)
+	}
+
+	// on-failure leaves a successful container alone
+	trueContainer, err := builder.Create(&Config{
+		Image: GetTestImage(runtime).ID,
+		Cmd:   []string{"/bin/true", ""},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(trueContainer)
+	if err := trueContainer.Start(&HostConfig{RestartPolicy: RestartPolicy{Name: "on-failure"}}); err != nil {
+		t.Fatal(err)
+	}
+	trueContainer.Wait()
+	time.Sleep(500 * time.Millisecond)
+	if trueContainer.State.RestartCount != 0 || trueContainer.State.Restarting {
+		t.Fatalf("A container exiting successfully shouldn't be restarted")
+	}
+
+	// always restarts the container until it is stopped
+	if err := trueContainer.Start(&HostConfig{RestartPolicy: RestartPolicy{Name: "always"}}); err != nil {
+		t.Fatal(err)
+	}
+	setTimeout(t, "The container was not restarted", 5*time.Second, func() {
+		for trueContainer.State.RestartCount < 2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	if err := trueContainer.Stop(3); err != nil {
+		t.Fatal(err)
+	}
+	count := trueContainer.State.RestartCount
+	time.Sleep(500 * time.Millisecond)
+	if trueContainer.State.Running || trueContainer.State.Restarting || trueContainer.State.RestartCount != count {
+		t.Fatalf("A stopped container shouldn't be restarted")
+	}
+}
+
 func TestRestart(t *testing.T) {
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 	container, err := NewBuilder(runtime).Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"echo", "-n", "foobar"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -592,7 +726,7 @@ func TestRestartStdin(t *testing.T) {
 		Cmd:   []string{"cat"},
 
 		OpenStdin: true,
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -661,6 +795,9 @@ func TestRestartStdin(t *testing.T) {
 }
 
 func TestUser(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't change the user")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -670,7 +807,7 @@ func TestUser(t *testing.T) {
 	container, err := builder.Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"id"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -690,7 +827,7 @@ func TestUser(t *testing.T) {
 		Cmd:   []string{"id"},
 
 		User: "root",
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -710,7 +847,7 @@ func TestUser(t *testing.T) {
 		Cmd:   []string{"id"},
 
 		User: "0",
-	},
+	}, "",
 	)
 	if err != nil || container.State.ExitCode != 0 {
 		t.Fatal(err)
@@ -730,7 +867,7 @@ func TestUser(t *testing.T) {
 		Cmd:   []string{"id"},
 
 		User: "1",
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -752,7 +889,7 @@ func TestUser(t *testing.T) {
 		Cmd:   []string{"id"},
 
 		User: "daemon",
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -772,7 +909,7 @@ func TestUser(t *testing.T) {
 		Cmd:   []string{"id"},
 
 		User: "unknownuser",
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -793,7 +930,7 @@ func TestMultipleContainers(t *testing.T) {
 	container1, err := builder.Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"sleep", "2"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -803,7 +940,7 @@ func TestMultipleContainers(t *testing.T) {
 	container2, err := builder.Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"sleep", "2"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -849,7 +986,7 @@ func TestStdin(t *testing.T) {
 		Cmd:   []string{"cat"},
 
 		OpenStdin: true,
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -886,6 +1023,294 @@ func TestStdin(t *testing.T) {
 	}
 }
 
+func TestExec(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+	container, hostConfig, err := mkContainer(runtime, []string{"-i", "_", "cat"}, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container)
+
+	if _, err := runtime.CreateExec(container, &ExecConfig{Cmd: []string{"true"}}); err == nil {
+		t.Fatal("Exec in a stopped container should fail")
+	}
+
+	stdin, err := container.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	if err := container.Start(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := runtime.CreateExec(container, &ExecConfig{
+		OpenStdin: true,
+		Cmd:       []string{"sh", "-c", "read line; echo $line; exit 3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := &bytes.Buffer{}
+	if err := e.Start(strings.NewReader("hello\n"), output, output); err != nil {
+		t.Fatal(err)
+	}
+	setTimeout(t, "Waiting for exec timed out", 2*time.Second, func() {
+		if exitCode := e.Wait(); exitCode != 3 {
+			t.Errorf("Unexpected exit code %d (expected 3)", exitCode)
+		}
+	})
+	if output.String() != "hello\n" {
+		t.Fatalf("Unexpected output. Expected %s, received: %s", "hello\n", output.String())
+	}
+	if err := e.Start(nil, output, output); err == nil {
+		t.Fatal("Starting an exec twice should fail")
+	}
+
+	// Execs are forgotten once their exit code is read
+	srv := &Server{runtime: runtime}
+	if exitCode, err := srv.ContainerExecWait(e.ID); err != nil || exitCode != 3 {
+		t.Fatalf("Unexpected exit code %d (expected 3): %v", exitCode, err)
+	}
+	if runtime.GetExec(e.ID) != nil {
+		t.Fatalf("The exec should have been removed once waited for")
+	}
+	// or after a while otherwise
+	defer func(ttl time.Duration) { execTTL = ttl }(execTTL)
+	execTTL = 10 * time.Millisecond
+	e, err = runtime.CreateExec(container, &ExecConfig{Cmd: []string{"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Start(nil, output, output); err != nil {
+		t.Fatal(err)
+	}
+	e.Wait()
+	time.Sleep(100 * time.Millisecond)
+	if runtime.GetExec(e.ID) != nil {
+		t.Fatalf("The exec should have been removed after execTTL")
+	}
+
+	// The main process is left untouched
+	if !container.State.Running {
+		t.Fatalf("The container should still be running")
+	}
+	if err := container.Stop(5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPause(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+	container, hostConfig, err := mkContainer(runtime, []string{"-i", "_", "cat"}, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container)
+
+	if err := container.Pause(); err == nil {
+		t.Fatal("Pausing a stopped container should fail")
+	}
+	stdin, err := container.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	stdout, err := container.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	if err := container.Start(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := container.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(container.State.String(), "(Paused)") {
+		t.Fatalf("Unexpected state: %s", container.State.String())
+	}
+	if err := container.Pause(); err == nil {
+		t.Fatal("Pausing a paused container should fail")
+	}
+
+	// A paused container does not process its input
+	output := make(chan string)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		output <- line
+	}()
+	if _, err := io.WriteString(stdin, "hello\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-output:
+		t.Fatalf("A paused container should not output anything, received %s", line)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := container.Unpause(); err != nil {
+		t.Fatal(err)
+	}
+	if container.State.Paused {
+		t.Fatalf("The container should not be paused anymore")
+	}
+	setTimeout(t, "Waiting for the output of the unpaused container timed out", 2*time.Second, func() {
+		if line := <-output; line != "hello\n" {
+			t.Fatalf("Unexpected output. Expected hello, received: %s", line)
+		}
+	})
+
+	// Stopping a paused container unpauses it first
+	if err := container.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := container.Stop(5); err != nil {
+		t.Fatal(err)
+	}
+	if container.State.Running || container.State.Paused {
+		t.Fatalf("The container should be stopped, found %s", container.State.String())
+	}
+}
+
+func TestLinks(t *testing.T) {
+	target := &Container{
+		NetworkSettings: &NetworkSettings{
+			IPAddress: "172.16.42.2",
+			PortMapping: map[string]PortMapping{
+				"Tcp": {"6379": "49153", "5432": "49154"},
+				"Udp": {"53": "49155"},
+			},
+		},
+	}
+	env := link{alias: "my-db", target: target}.env("webapp")
+	expected := []string{
+		"MY_DB_NAME=/webapp/my-db",
+		"MY_DB_PORT=tcp://172.16.42.2:5432",
+		"MY_DB_PORT_5432_TCP=tcp://172.16.42.2:5432",
+		"MY_DB_PORT_5432_TCP_ADDR=172.16.42.2",
+		"MY_DB_PORT_5432_TCP_PORT=5432",
+		"MY_DB_PORT_5432_TCP_PROTO=tcp",
+		"MY_DB_PORT_6379_TCP=tcp://172.16.42.2:6379",
+		"MY_DB_PORT_6379_TCP_ADDR=172.16.42.2",
+		"MY_DB_PORT_6379_TCP_PORT=6379",
+		"MY_DB_PORT_6379_TCP_PROTO=tcp",
+		"MY_DB_PORT_53_UDP=udp://172.16.42.2:53",
+		"MY_DB_PORT_53_UDP_ADDR=172.16.42.2",
+		"MY_DB_PORT_53_UDP_PORT=53",
+		"MY_DB_PORT_53_UDP_PROTO=udp",
+	}
+	if strings.Join(env, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Unexpected link environment:\n%s", strings.Join(env, "\n"))
+	}
+
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+	db, _, err := mkContainer(runtime, []string{"_", "true"}, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(db)
+	if err := runtime.Rename(db, "db"); err != nil {
+		t.Fatal(err)
+	}
+	container, hostConfig, err := mkContainer(runtime, []string{"-link", "db:db", "_", "true"}, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container)
+	if len(hostConfig.Links) != 1 || hostConfig.Links[0] != "db:db" {
+		t.Fatalf("Unexpected links: %v", hostConfig.Links)
+	}
+	if err := container.Start(hostConfig); err == nil {
+		t.Fatalf("Linking to a stopped container should fail")
+	}
+}
+
+func TestDns(t *testing.T) {
+	hostConf := []byte("# Generated\ndomain local\nnameserver 127.0.0.1\n\noptions ndots:2\n")
+	if conf := string(buildResolvConf(hostConf, nil, nil)); conf != "# Generated\ndomain local\nnameserver 127.0.0.1\noptions ndots:2\n" {
+		t.Fatalf("The resolv.conf of the host should be kept as is, found:\n%s", conf)
+	}
+	conf := string(buildResolvConf(hostConf, []string{"10.0.0.2", "10.0.0.3"}, []string{"example.com", "example.org"}))
+	if conf != "# Generated\noptions ndots:2\nnameserver 10.0.0.2\nnameserver 10.0.0.3\nsearch example.com example.org\n" {
+		t.Fatalf("Unexpected resolv.conf:\n%s", conf)
+	}
+
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+	container, hostConfig, err := mkContainer(runtime, []string{"-h", "myhost", "-dns", "10.0.0.2", "-dns-search", "example.com", "_", "true"}, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container)
+	if err := container.Start(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+	container.Wait()
+
+	resolvConf := readFile(container.ResolvConfPath, t)
+	if !strings.Contains(resolvConf, "nameserver 10.0.0.2\n") || !strings.Contains(resolvConf, "search example.com\n") {
+		t.Fatalf("Unexpected resolv.conf:\n%s", resolvConf)
+	}
+	if hosts := readFile(container.HostsPath, t); !strings.Contains(hosts, "\tmyhost\n") {
+		t.Fatalf("The hosts file should contain the hostname, found:\n%s", hosts)
+	}
+	// The rootfs is unmounted when the container exits
+	if err := container.EnsureMounted(); err != nil {
+		t.Fatal(err)
+	}
+	defer container.Unmount()
+	for _, name := range []string{"etc/resolv.conf", "etc/hosts"} {
+		if _, err := os.Lstat(path.Join(container.RootfsPath(), name)); err != nil {
+			t.Fatalf("The target of the bind mount of /%s should exist (%s)", name, err)
+		}
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	container := &Container{State: State{Health: &Health{Status: healthStarting}}}
+	for i, expected := range []string{healthStarting, healthUnhealthy, healthHealthy, healthHealthy, healthUnhealthy} {
+		exitCode := 1
+		if i == 2 {
+			exitCode = 0
+		}
+		container.updateHealth(&HealthResult{ExitCode: exitCode}, 2)
+		if status := container.State.Health.Status; status != expected {
+			t.Fatalf("Expected %s after check %d, found %s", expected, i, status)
+		}
+	}
+	if len(container.State.Health.Log) != maxHealthLog {
+		t.Fatalf("Expected the last %d results to be kept, found %d", maxHealthLog, len(container.State.Health.Log))
+	}
+
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+	container, hostConfig, err := mkContainer(runtime, []string{"-health-cmd", "echo ok", "-health-interval", "1", "_", "sleep", "10"}, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container)
+	if err := container.Start(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+	defer container.Kill()
+	if !strings.HasSuffix(container.State.String(), "(starting)") {
+		t.Fatalf("Unexpected state: %s", container.State.String())
+	}
+	setTimeout(t, "The container should have become healthy", 5*time.Second, func() {
+		for container.State.health().Status != healthHealthy {
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+	if output := container.State.health().Log[0].Output; output != "ok\n" {
+		t.Fatalf("Unexpected output of the health check: %q", output)
+	}
+}
+
 func TestTty(t *testing.T) {
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
@@ -894,7 +1319,7 @@ func TestTty(t *testing.T) {
 		Cmd:   []string{"cat"},
 
 		OpenStdin: true,
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -937,7 +1362,7 @@ func TestEnv(t *testing.T) {
 	container, err := NewBuilder(runtime).Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"env"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -963,10 +1388,16 @@ func TestEnv(t *testing.T) {
 		actualEnv = actualEnv[:len(actualEnv)-1]
 	}
 	sort.Strings(actualEnv)
+	// HOME is the home of root in the image, set by dockerinit, and / for
+	// the image of the fake mode which has no /etc/passwd
+	home := "HOME=/root"
+	if unitTestFake {
+		home = "HOME=/"
+	}
 	goodEnv := []string{
 		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
-		"HOME=/",
-		"container=lxc",
+		home,
+		"container=" + runtime.execDriver.Name(),
 		"HOSTNAME=" + container.ShortID(),
 	}
 	sort.Strings(goodEnv)
@@ -988,7 +1419,7 @@ func TestEntrypoint(t *testing.T) {
 			Image:      GetTestImage(runtime).ID,
 			Entrypoint: []string{"/bin/echo"},
 			Cmd:        []string{"-n", "foobar"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1010,7 +1441,7 @@ func TestEntrypointNoCmd(t *testing.T) {
 		&Config{
 			Image:      GetTestImage(runtime).ID,
 			Entrypoint: []string{"/bin/echo", "foobar"},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1061,10 +1492,12 @@ func TestLXCConfig(t *testing.T) {
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"/bin/true"},
 
-		Hostname:  "foobar",
-		Memory:    int64(mem),
-		CpuShares: int64(cpu),
-	},
+		Hostname:   "foobar",
+		Memory:     int64(mem),
+		CpuShares:  int64(cpu),
+		CpusetCpus: "0",
+		PidsLimit:  64,
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1076,6 +1509,9 @@ func TestLXCConfig(t *testing.T) {
 		fmt.Sprintf("lxc.cgroup.memory.limit_in_bytes = %d", mem))
 	grepFile(t, container.lxcConfigPath(),
 		fmt.Sprintf("lxc.cgroup.memory.memsw.limit_in_bytes = %d", mem*2))
+	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.cpuset.cpus = 0")
+	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.pids.max = 64")
+	grepFile(t, container.lxcConfigPath(), "lxc.cap.drop = audit_control audit_write mac_admin")
 }
 
 func TestCustomLxcConfig(t *testing.T) {
@@ -1086,7 +1522,7 @@ func TestCustomLxcConfig(t *testing.T) {
 		Cmd:   []string{"/bin/true"},
 
 		Hostname: "foobar",
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1102,10 +1538,17 @@ func TestCustomLxcConfig(t *testing.T) {
 			Value: "0,1",
 		},
 	}}
+	hostConfig.Devices = []DeviceMapping{{"/dev/null", "/dev/null", "r"}}
+	hostConfig.ReadonlyRootfs = true
+	hostConfig.Tmpfs = map[string]string{"/run": "size=64m,exec"}
 
 	container.generateLXCConfig(hostConfig)
 	grepFile(t, container.lxcConfigPath(), "lxc.utsname = docker")
 	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.cpuset.cpus = 0,1")
+	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.devices.allow = c 1:3 r")
+	grepFile(t, container.lxcConfigPath(), "lxc.mount.entry = /dev/null dev/null none bind,create=file 0 0")
+	grepFile(t, container.lxcConfigPath(), "lxc.rootfs.options = ro")
+	grepFile(t, container.lxcConfigPath(), "lxc.mount.entry = tmpfs run tmpfs nosuid,nodev,noexec,size=64m,exec 0 0")
 }
 
 func BenchmarkRunSequencial(b *testing.B) {
@@ -1115,7 +1558,7 @@ func BenchmarkRunSequencial(b *testing.B) {
 		container, err := NewBuilder(runtime).Create(&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{"echo", "-n", "foo"},
-		},
+		}, "",
 		)
 		if err != nil {
 			b.Fatal(err)
@@ -1147,7 +1590,7 @@ func BenchmarkRunParallel(b *testing.B) {
 			container, err := NewBuilder(runtime).Create(&Config{
 				Image: GetTestImage(runtime).ID,
 				Cmd:   []string{"echo", "-n", "foo"},
-			},
+			}, "",
 			)
 			if err != nil {
 				complete <- err
@@ -1194,6 +1637,9 @@ func tempDir(t *testing.T) string {
 }
 
 func TestBindMounts(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	r := mkRuntime(t)
 	defer nuke(r)
 	tmpDir := tempDir(t)
@@ -1225,7 +1671,7 @@ func TestVolumesFromReadonlyMount(t *testing.T) {
 			Image:   GetTestImage(runtime).ID,
 			Cmd:     []string{"/bin/echo", "-n", "foobar"},
 			Volumes: map[string]struct{}{"/test": {}},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1244,7 +1690,7 @@ func TestVolumesFromReadonlyMount(t *testing.T) {
 			Image:       GetTestImage(runtime).ID,
 			Cmd:         []string{"/bin/echo", "-n", "foobar"},
 			VolumesFrom: container.ID,
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1279,7 +1725,7 @@ func TestRestartWithVolumes(t *testing.T) {
 		Image:   GetTestImage(runtime).ID,
 		Cmd:     []string{"echo", "-n", "foobar"},
 		Volumes: map[string]struct{}{"/test": {}},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1315,6 +1761,9 @@ func TestRestartWithVolumes(t *testing.T) {
 
 // Test for #1351
 func TestVolumesFromWithVolumes(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't chroot into the root filesystem")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -1322,7 +1771,7 @@ func TestVolumesFromWithVolumes(t *testing.T) {
 		Image:   GetTestImage(runtime).ID,
 		Cmd:     []string{"sh", "-c", "echo -n bar > /test/foo"},
 		Volumes: map[string]struct{}{"/test": {}},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1351,7 +1800,7 @@ func TestVolumesFromWithVolumes(t *testing.T) {
 			Cmd:         []string{"cat", "/test/foo"},
 			VolumesFrom: container.ID,
 			Volumes:     map[string]struct{}{"/test": {}},
-		},
+		}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -1379,6 +1828,9 @@ func TestVolumesFromWithVolumes(t *testing.T) {
 }
 
 func TestOnlyLoopbackExistsWhenUsingDisableNetworkOption(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver doesn't create a network namespace")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 
@@ -1386,7 +1838,7 @@ func TestOnlyLoopbackExistsWhenUsingDisableNetworkOption(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	c, err := NewBuilder(runtime).Create(config)
+	c, err := NewBuilder(runtime).Create(config, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1417,6 +1869,9 @@ func TestOnlyLoopbackExistsWhenUsingDisableNetworkOption(t *testing.T) {
 }
 
 func TestPrivilegedCanMknod(t *testing.T) {
+	if unitTestFake {
+		t.Skip("Privileged containers need root")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 	if output, _ := runContainer(runtime, []string{"-privileged", "_", "sh", "-c", "mknod /tmp/sda b 8 0 && echo ok"}, t); output != "ok\n" {
@@ -1425,6 +1880,9 @@ func TestPrivilegedCanMknod(t *testing.T) {
 }
 
 func TestPrivilegedCanMount(t *testing.T) {
+	if unitTestFake {
+		t.Skip("Privileged containers need root")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 	if output, _ := runContainer(runtime, []string{"-privileged", "_", "sh", "-c", "mount -t tmpfs none /tmp && echo ok"}, t); output != "ok\n" {
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+)
+
+// deviceCgroupRule returns the devices.allow entry giving access to the
+// device of the host mapped by device, e.g. c 10:229 rwm.
+func deviceCgroupRule(device DeviceMapping) (string, error) {
+	f, err := os.Stat(device.PathOnHost)
+	if err != nil {
+		return "", err
+	}
+	kind, err := deviceType(f)
+	if err != nil {
+		return "", err
+	}
+	major, minor := deviceMajorMinor(f)
+	return fmt.Sprintf("%s %d:%d %s", kind, major, minor, device.CgroupPermissions), nil
+}
+
+// deviceType returns b for a block device, and c for a character device.
+func deviceType(f os.FileInfo) (string, error) {
+	if f.Mode()&os.ModeDevice == 0 {
+		return "", fmt.Errorf("%s is not a device", f.Name())
+	}
+	if f.Mode()&os.ModeCharDevice != 0 {
+		return "c", nil
+	}
+	return "b", nil
+}
+
+func deviceMajorMinor(f os.FileInfo) (uint64, uint64) {
+	rdev := uint64(f.Sys().(*syscall.Stat_t).Rdev)
+	return (rdev >> 8) & 0xfff, (rdev & 0xff) | ((rdev >> 12) & 0xfff00)
+}
+
+// createDeviceNodes creates the nodes of the devices given to run -device
+// below root, with the owner and mode of the ones of the host. Whatever is
+// at their place is replaced. The native driver runs it on the tmpfs it
+// mounts on /dev each time the container starts, so that they don't end up
+// in the root filesystem.
+func createDeviceNodes(root string, devices []DeviceMapping) error {
+	for _, device := range devices {
+		f, err := os.Stat(device.PathOnHost)
+		if err != nil {
+			return err
+		}
+		kind, err := deviceType(f)
+		if err != nil {
+			return err
+		}
+		mode := uint32(f.Mode().Perm())
+		if kind == "c" {
+			mode |= syscall.S_IFCHR
+		} else {
+			mode |= syscall.S_IFBLK
+		}
+		stat := f.Sys().(*syscall.Stat_t)
+
+		target := path.Join(root, device.PathInContainer)
+		if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := syscall.Mknod(target, mode, int(stat.Rdev)); err != nil {
+			return fmt.Errorf("Unable to create device %s: %s", device.PathInContainer, err)
+		}
+		// The umask applies to mknod
+		if err := os.Chmod(target, f.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chown(target, int(stat.Uid), int(stat.Gid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
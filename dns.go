@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// setupDns generates the resolv.conf and hosts files of the container, to be
+// bind mounted over the ones of its image.
+func (container *Container) setupDns(links []link) error {
+	if err := container.writeResolvConf(); err != nil {
+		return err
+	}
+	if err := container.writeHosts(links); err != nil {
+		return err
+	}
+	// The bind mounts need targets. Don't follow the symlinks some images
+	// have there: they would point to the files of the host.
+	for _, name := range []string{"etc/resolv.conf", "etc/hosts"} {
+		target := path.Join(container.RootfsPath(), name)
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, []byte{}, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResolvConf writes the resolv.conf of the container: the one of the
+// host, with the dns servers and search domains of the container, or else
+// of the runtime, instead of its own.
+func (container *Container) writeResolvConf() error {
+	hostConf, err := utils.GetResolvConf()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dns := container.Config.Dns
+	if len(dns) == 0 {
+		dns = container.runtime.Dns
+	}
+	// A server listening on the loopback of the host is out of reach
+	if len(dns) == 0 && utils.CheckLocalDns(hostConf) {
+		dns = defaultDns
+	}
+	container.ResolvConfPath = path.Join(container.root, "resolv.conf")
+	return ioutil.WriteFile(container.ResolvConfPath, buildResolvConf(hostConf, dns, container.Config.DnsSearch), 0644)
+}
+
+// buildResolvConf returns hostConf with its nameservers replaced by dns, and
+// its search domains by search, unless they are empty.
+func buildResolvConf(hostConf []byte, dns, search []string) []byte {
+	buf := &bytes.Buffer{}
+	for _, line := range strings.Split(string(hostConf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			if len(dns) > 0 {
+				continue
+			}
+		case "search", "domain":
+			if len(search) > 0 {
+				continue
+			}
+		}
+		fmt.Fprintln(buf, line)
+	}
+	for _, server := range dns {
+		fmt.Fprintf(buf, "nameserver %s\n", server)
+	}
+	if len(search) > 0 {
+		fmt.Fprintf(buf, "search %s\n", strings.Join(search, " "))
+	}
+	return buf.Bytes()
+}
+
+// writeHosts writes the hosts file of the container: its own hostname,
+// followed by the aliases of its links.
+func (container *Container) writeHosts(links []link) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "127.0.0.1\tlocalhost\n")
+	fmt.Fprintf(buf, "::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if ip := container.NetworkSettings.IPAddress; ip != "" {
+		fmt.Fprintf(buf, "%s\t%s\n", ip, container.Config.Hostname)
+	} else {
+		fmt.Fprintf(buf, "127.0.1.1\t%s\n", container.Config.Hostname)
+	}
+	for _, l := range links {
+		fmt.Fprintf(buf, "%s\t%s\n", l.target.NetworkSettings.IPAddress, l.alias)
+	}
+	container.HostsPath = path.Join(container.root, "hosts")
+	// Write in place, a new file would not show through the bind mount
+	return ioutil.WriteFile(container.HostsPath, buf.Bytes(), 0644)
+}
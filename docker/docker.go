@@ -20,7 +20,7 @@ var (
 )
 
 func main() {
-	if selfPath := utils.SelfPath(); selfPath == "/sbin/init" || selfPath == "/.dockerinit" {
+	if docker.IsSysInit() {
 		// Running in init mode
 		docker.SysInit()
 		return
@@ -35,6 +35,8 @@ func main() {
 	flGraphPath := flag.String("g", "/var/lib/docker", "Path to graph storage base dir.")
 	flEnableCors := flag.Bool("api-enable-cors", false, "Enable CORS requests in the remote api.")
 	flDns := flag.String("dns", "", "Set custom dns servers")
+	flExecDriver := flag.String("e", docker.DefaultExecDriver, fmt.Sprintf("Execution driver used to run containers (%s)", strings.Join(docker.ExecDrivers(), ", ")))
+	flGraphDriver := flag.String("s", "", fmt.Sprintf("Storage driver used for images and containers (%s). Defaults to the one the graph was created with, or %s", strings.Join(docker.GraphDrivers(), ", "), docker.DefaultGraphDriver))
 	flHosts := docker.ListOpts{fmt.Sprintf("unix://%s", docker.DEFAULTUNIXSOCKET)}
 	flag.Var(&flHosts, "H", "tcp://host:port to bind/connect to or unix://path/to/socket to use")
 	flag.Parse()
@@ -54,6 +56,8 @@ func main() {
 	} else {
 		docker.NetworkBridgeIface = docker.DefaultNetworkBridge
 	}
+	docker.ExecDriverName = *flExecDriver
+	docker.GraphDriverName = *flGraphDriver
 	if *flDebug {
 		os.Setenv("DEBUG", "1")
 	}
@@ -75,6 +79,9 @@ func main() {
 		}
 		protoAddrParts := strings.SplitN(flHosts[0], "://", 2)
 		if err := docker.ParseCommands(protoAddrParts[0], protoAddrParts[1], flag.Args()...); err != nil {
+			if sterr, ok := err.(*utils.StatusError); ok {
+				os.Exit(sterr.Status)
+			}
 			log.Fatal(err)
 			os.Exit(-1)
 		}
@@ -0,0 +1,270 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/term"
+	"github.com/dotcloud/docker/utils"
+	"github.com/kr/pty"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// execTTL is how long the runtime keeps an exec after its process exited,
+// for its exit code to be read.
+var execTTL = 5 * time.Minute
+
+// ExecConfig describes a process to be run in a running container, next to
+// its main process.
+type ExecConfig struct {
+	User      string
+	Tty       bool
+	OpenStdin bool
+	Cmd       []string
+}
+
+// Exec is a process run in a running container with docker exec.
+type Exec struct {
+	ID       string
+	Config   *ExecConfig
+	Running  bool
+	ExitCode int
+
+	container *Container
+	// Guards started, Running, ExitCode and the tty, which the API may
+	// resize while the process starts
+	lock      sync.Mutex
+	started   bool
+	cmd       *exec.Cmd
+	ptyMaster *os.File
+	ttySize   *term.Winsize
+	streams   sync.WaitGroup
+	waitLock  chan struct{}
+}
+
+// CreateExec prepares config to be run in container, which must be running.
+func (runtime *Runtime) CreateExec(container *Container, config *ExecConfig) (*Exec, error) {
+	e, err := newExec(container, config)
+	if err != nil {
+		return nil, err
+	}
+	runtime.execsLock.Lock()
+	runtime.execs[e.ID] = e
+	runtime.execsLock.Unlock()
+	return e, nil
+}
+
+// newExec is CreateExec without registering the exec in the runtime, for
+// the ones the daemon runs itself.
+func newExec(container *Container, config *ExecConfig) (*Exec, error) {
+	if !container.State.Running {
+		return nil, fmt.Errorf("Impossible to exec in container %s: it is not running", container.ID)
+	}
+	if container.State.Paused {
+		return nil, fmt.Errorf("Impossible to exec in container %s: it is paused", container.ID)
+	}
+	if len(config.Cmd) == 0 {
+		return nil, fmt.Errorf("No command specified")
+	}
+	return &Exec{
+		ID:        GenerateID(),
+		Config:    config,
+		container: container,
+		waitLock:  make(chan struct{}),
+	}, nil
+}
+
+// GetExec returns the exec with the given id, or nil.
+func (runtime *Runtime) GetExec(id string) *Exec {
+	runtime.execsLock.Lock()
+	defer runtime.execsLock.Unlock()
+	return runtime.execs[id]
+}
+
+// removeExec forgets the exec id, once its exit code was read or it
+// expired.
+func (runtime *Runtime) removeExec(id string) {
+	runtime.execsLock.Lock()
+	delete(runtime.execs, id)
+	runtime.execsLock.Unlock()
+}
+
+// Start runs the process of e in its container. Its output is copied to
+// stdout and stderr, or only to stdout with a tty, and stdin to its input
+// if OpenStdin is set.
+func (e *Exec) Start(stdin io.Reader, stdout, stderr io.Writer) error {
+	e.lock.Lock()
+	if e.started {
+		e.lock.Unlock()
+		return fmt.Errorf("Conflict, exec %s has already been started", e.ID)
+	}
+	e.started = true
+	e.lock.Unlock()
+	if err := e.start(stdin, stdout, stderr); err != nil {
+		// Don't leave Wait blocked forever
+		e.lock.Lock()
+		e.ExitCode = -1
+		e.lock.Unlock()
+		e.exited()
+		return err
+	}
+	return nil
+}
+
+func (e *Exec) start(stdin io.Reader, stdout, stderr io.Writer) error {
+	container := e.container
+	if !container.State.Running {
+		return fmt.Errorf("Impossible to exec in container %s: it is not running", container.ID)
+	}
+
+	// Arguments passed to dockerinit
+	params := []string{}
+	user := e.Config.User
+	if user == "" {
+		user = container.Config.User
+	}
+	if user != "" {
+		params = append(params, "-u", user)
+	}
+	for _, ulimit := range container.Config.Ulimits {
+		params = append(params, "-ulimit", ulimit.String())
+	}
+	params = append(params, container.environment(e.Config.Tty)...)
+	if container.Config.WorkingDir != "" {
+		params = append(params, "-w", path.Clean(container.Config.WorkingDir))
+	}
+	params = append(params, "--")
+	params = append(params, e.Config.Cmd...)
+
+	cmd, err := container.runtime.execDriver.Exec(container, params)
+	if err != nil {
+		return err
+	}
+	if !e.Config.OpenStdin {
+		stdin = nil
+	}
+
+	if e.Config.Tty {
+		ptyMaster, ptySlave, err := pty.Open()
+		if err != nil {
+			return err
+		}
+		defer ptySlave.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = ptySlave, ptySlave, ptySlave
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Setctty = true
+		cmd.SysProcAttr.Setsid = true
+		e.lock.Lock()
+		e.ptyMaster = ptyMaster
+		if e.ttySize != nil {
+			term.SetWinsize(ptyMaster.Fd(), e.ttySize)
+		}
+		e.lock.Unlock()
+
+		e.streams.Add(1)
+		go func() {
+			defer e.streams.Done()
+			io.Copy(stdout, ptyMaster)
+		}()
+		if stdin != nil {
+			go io.Copy(ptyMaster, stdin)
+		}
+	} else {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if stdin != nil {
+			// Let the process see the end of its input as soon as stdin
+			// is closed, which exec.Cmd would only do on exit
+			r, w, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			cmd.Stdin = r
+			go func() {
+				defer w.Close()
+				io.Copy(w, stdin)
+			}()
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		if e.ptyMaster != nil {
+			e.ptyMaster.Close()
+		}
+		return err
+	}
+	e.lock.Lock()
+	e.cmd = cmd
+	e.Running = true
+	e.lock.Unlock()
+	go e.monitor()
+	return nil
+}
+
+func (e *Exec) monitor() {
+	if err := e.cmd.Wait(); err != nil {
+		// Discard the error as any signals or non 0 returns will generate an error
+		utils.Debugf("exec %s: Process: %s", e.ID, err)
+	}
+	// Wait for the output to be flushed
+	e.streams.Wait()
+	if e.ptyMaster != nil {
+		e.ptyMaster.Close()
+	}
+	e.lock.Lock()
+	e.ExitCode = e.cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+	e.Running = false
+	e.lock.Unlock()
+	e.exited()
+}
+
+// exited releases the waiters of e, and has the runtime forget it after
+// execTTL.
+func (e *Exec) exited() {
+	if runtime := e.container.runtime; runtime != nil {
+		time.AfterFunc(execTTL, func() {
+			runtime.removeExec(e.ID)
+		})
+	}
+	close(e.waitLock)
+}
+
+// Kill kills the process of e, if it is running.
+func (e *Exec) Kill() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !e.Running {
+		return nil
+	}
+	return e.cmd.Process.Kill()
+}
+
+// Wait blocks until the process of e exits, and returns its exit code.
+func (e *Exec) Wait() int {
+	<-e.waitLock
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.ExitCode
+}
+
+// Resize sets the size of the tty of e. It can be called before Start, as
+// the client does not know when the tty gets allocated.
+func (e *Exec) Resize(h, w int) error {
+	if !e.Config.Tty {
+		return fmt.Errorf("Exec %s has no tty", e.ID)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.ttySize = &term.Winsize{Height: uint16(h), Width: uint16(w)}
+	if e.ptyMaster == nil {
+		return nil
+	}
+	return term.SetWinsize(e.ptyMaster.Fd(), e.ttySize)
+}
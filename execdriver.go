@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+)
+
+// ExecDriverName is the name of the execution driver used by the runtime.
+var ExecDriverName string
+
+const DefaultExecDriver = "lxc"
+
+// ExecDriver is the interface implemented by the backends which run the
+// processes of containers (lxc, ...).
+type ExecDriver interface {
+	// Name returns the name under which the driver was registered.
+	Name() string
+	// Command returns the command which runs the container's process.
+	// args are the arguments to be passed to dockerinit inside the container.
+	Command(container *Container, hostConfig *HostConfig, args []string) (*exec.Cmd, error)
+	// Run starts a command previously returned by Command, once its
+	// standard streams have been set up.
+	Run(container *Container, cmd *exec.Cmd) error
+	// Exec returns the command which runs a new process in the namespaces
+	// of the running container. args are passed to dockerinit as for Command.
+	Exec(container *Container, args []string) (*exec.Cmd, error)
+	// Pause freezes all the processes of the container, until Unpause.
+	Pause(container *Container) error
+	Unpause(container *Container) error
+	// Kill sends the signal sig to the container's process.
+	Kill(container *Container, sig int) error
+	// Info reports the state of the container as seen by the driver.
+	Info(container *Container) (*ExecInfo, error)
+	// Pids returns the host pids of all the processes running in the container.
+	Pids(container *Container) ([]int, error)
+	// Terminate releases the resources held for the container once its
+	// process has exited.
+	Terminate(container *Container) error
+}
+
+type ExecInfo struct {
+	Running bool
+	Pid     int
+}
+
+type execDriverInitFunc func(root string) (ExecDriver, error)
+
+var execDrivers = make(map[string]execDriverInitFunc)
+
+func registerExecDriver(name string, initFunc execDriverInitFunc) {
+	if _, exists := execDrivers[name]; exists {
+		panic(fmt.Sprintf("Execution driver %s registered twice", name))
+	}
+	execDrivers[name] = initFunc
+}
+
+// ExecDrivers returns the sorted names of the available execution drivers.
+func ExecDrivers() []string {
+	var names []string
+	for name := range execDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newExecDriver(name, root string) (ExecDriver, error) {
+	initFunc, exists := execDrivers[name]
+	if !exists {
+		return nil, fmt.Errorf("Unknown execution driver: %s", name)
+	}
+	return initFunc(root)
+}
@@ -0,0 +1,135 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func init() {
+	registerExecDriver("fake", func(root string) (ExecDriver, error) {
+		return &fakeDriver{}, nil
+	})
+}
+
+// fakeDriver runs the command of the container as a plain child process of
+// the test binary, from the root filesystem of the container but without
+// chrooting into it. It needs neither root nor any kernel feature.
+type fakeDriver struct {
+}
+
+func (d *fakeDriver) Name() string {
+	return "fake"
+}
+
+func (d *fakeDriver) Command(container *Container, hostConfig *HostConfig, args []string) (*exec.Cmd, error) {
+	var env []string
+	workdir := "/"
+	// Only keep what matters outside of a container from the dockerinit
+	// arguments: the environment and the working directory.
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-e":
+			i++
+			env = append(env, args[i])
+		case "-w":
+			i++
+			workdir = args[i]
+		case "-g", "-u", "-ulimit":
+			i++
+		case "--":
+			args = args[i+1:]
+			i = len(args)
+		}
+	}
+	// Like dockerinit does with an image without /etc/passwd, which the
+	// image of the fake mode is
+	home := "HOME=/"
+	for _, value := range env {
+		if strings.HasPrefix(value, "HOME=") {
+			home = ""
+		}
+	}
+	if home != "" {
+		env = append(env, home)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Dir = path.Join(container.RootfsPath(), workdir)
+	// Put the process in its own group so that Kill reaches its children.
+	// With a tty, the new session does it already.
+	if !container.Config.Tty {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	return cmd, nil
+}
+
+func (d *fakeDriver) Run(container *Container, cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+func (d *fakeDriver) Exec(container *Container, args []string) (*exec.Cmd, error) {
+	cmd, err := d.Command(container, nil, args)
+	if err != nil {
+		return nil, err
+	}
+	// The process group is the one of the container's process
+	cmd.SysProcAttr = nil
+	return cmd, nil
+}
+
+// Stopping the process group stands in for the freezer cgroup.
+func (d *fakeDriver) Pause(container *Container) error {
+	return syscall.Kill(-container.State.Pid, syscall.SIGSTOP)
+}
+
+func (d *fakeDriver) Unpause(container *Container) error {
+	return syscall.Kill(-container.State.Pid, syscall.SIGCONT)
+}
+
+func (d *fakeDriver) Kill(container *Container, sig int) error {
+	return syscall.Kill(-container.State.Pid, syscall.Signal(sig))
+}
+
+func (d *fakeDriver) Info(container *Container) (*ExecInfo, error) {
+	if container.State.Pid == 0 || syscall.Kill(container.State.Pid, 0) != nil {
+		return &ExecInfo{}, nil
+	}
+	return &ExecInfo{Running: true, Pid: container.State.Pid}, nil
+}
+
+// Pids returns the members of the process group of the container.
+func (d *fakeDriver) Pids(container *Container) ([]int, error) {
+	pgid := container.State.Pid
+	dirs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return []int{pgid}, nil
+	}
+	var pids []int
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(dir.Name())
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join("/proc", dir.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The process group comes third after the command, which is
+		// between parentheses and may contain spaces.
+		fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+		if len(fields) > 2 && fields[2] == strconv.Itoa(pgid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// Terminate kills whatever the process left behind in its group.
+func (d *fakeDriver) Terminate(container *Container) error {
+	syscall.Kill(-container.State.Pid, syscall.SIGKILL)
+	return nil
+}
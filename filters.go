@@ -0,0 +1,209 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filters restrict what the API lists to the containers, images or events
+// matching them, e.g. {"label": ["team=payments"]}. They are given in JSON
+// by the filters query parameter. An item matches when it matches one of the
+// values of each filter, or all of them for label.
+type Filters map[string][]string
+
+// The filters of /containers/json, /images/json and /events
+var (
+	containerFilters = []string{"label", "status", "exited", "ancestor", "name", "created-before", "created-after"}
+	imageFilters     = []string{"label", "dangling", "ancestor", "name", "created-before", "created-after"}
+	eventFilters     = []string{"label"}
+)
+
+// parseFilters parses the filters query parameter. Only the keys in accepted
+// are valid.
+func parseFilters(value string, accepted ...string) (Filters, error) {
+	filters := Filters{}
+	if value == "" {
+		return filters, nil
+	}
+	if err := json.Unmarshal([]byte(value), &filters); err != nil {
+		return nil, fmt.Errorf("Bad parameter: invalid filters: %s", err)
+	}
+	for key, values := range filters {
+		valid := false
+		for _, a := range accepted {
+			if key == a {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("Bad parameter: invalid filter: %s", key)
+		}
+		for _, v := range values {
+			if err := checkFilter(key, v); err != nil {
+				return nil, fmt.Errorf("Bad parameter: invalid value for the %s filter: %s", key, err)
+			}
+		}
+	}
+	return filters, nil
+}
+
+// checkFilter returns an error if value can't be given to the filter key.
+func checkFilter(key, value string) error {
+	switch key {
+	case "status":
+		switch value {
+		case "created", "running", "paused", "restarting", "exited":
+		default:
+			return fmt.Errorf("%s (expected created, running, paused, restarting or exited)", value)
+		}
+	case "exited":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s is not an exit code", value)
+		}
+	case "created-before", "created-after":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%s is not a timestamp", value)
+		}
+	case "dangling":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s (expected true or false)", value)
+		}
+	case "name":
+		if _, err := path.Match(value, ""); err != nil {
+			return fmt.Errorf("%s is not a valid pattern", value)
+		}
+	}
+	return nil
+}
+
+// filtersFromFlags builds the filters query parameter out of the -f flags of
+// the client, given as key=value.
+func filtersFromFlags(values []string) (string, error) {
+	filters := Filters{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return "", fmt.Errorf("Invalid filter: %s (expected key=value)", value)
+		}
+		filters[parts[0]] = append(filters[parts[0]], parts[1])
+	}
+	buf, err := json.Marshal(filters)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// match tells whether one of the values of the filter key matches, or
+// whether there is no such filter.
+func (filters Filters) match(key string, matches func(value string) bool) bool {
+	values := filters[key]
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if matches(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLabels tells whether labels have all the labels of the label filters,
+// given as key, for any value, or key=value.
+func (filters Filters) matchLabels(labels map[string]string) bool {
+	for _, filter := range filters["label"] {
+		parts := strings.SplitN(filter, "=", 2)
+		value, exists := labels[parts[0]]
+		if !exists || (len(parts) == 2 && value != parts[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCreated tells whether created is within the created-before and
+// created-after filters, timestamps in seconds.
+func (filters Filters) matchCreated(created time.Time) bool {
+	before := filters.match("created-before", func(value string) bool {
+		timestamp, _ := strconv.ParseInt(value, 10, 64)
+		return created.Unix() < timestamp
+	})
+	after := filters.match("created-after", func(value string) bool {
+		timestamp, _ := strconv.ParseInt(value, 10, 64)
+		return created.Unix() > timestamp
+	})
+	return before && after
+}
+
+// matchNames tells whether one of names matches the patterns of the name
+// filters.
+func (filters Filters) matchNames(names ...string) bool {
+	return filters.match("name", func(pattern string) bool {
+		for _, name := range names {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// matchAncestors tells whether image is one of ancestors, the IDs of the
+// images of the ancestor filters, or is built on one of them.
+func (filters Filters) matchAncestors(image *Image, ancestors map[string]bool) bool {
+	if len(filters["ancestor"]) == 0 {
+		return true
+	}
+	if image == nil {
+		return false
+	}
+	history, err := image.History()
+	if err != nil {
+		return false
+	}
+	for _, img := range history {
+		if ancestors[img.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchContainer tells whether container matches the filters, but the
+// ancestor one, which needs its image.
+func (filters Filters) matchContainer(container *Container) bool {
+	status := container.State.status()
+	return filters.matchLabels(container.Config.Labels) &&
+		filters.match("status", func(value string) bool {
+			return value == status
+		}) &&
+		filters.match("exited", func(value string) bool {
+			code, _ := strconv.Atoi(value)
+			return status == "exited" && container.State.ExitCode == code
+		}) &&
+		filters.matchNames(container.Name) &&
+		filters.matchCreated(container.Created)
+}
+
+// matchImage tells whether image, tagged with names, matches the filters,
+// but the ancestor one. Images without names are dangling.
+func (filters Filters) matchImage(image *Image, names ...string) bool {
+	return filters.matchLabels(image.labels()) &&
+		filters.match("dangling", func(value string) bool {
+			dangling, _ := strconv.ParseBool(value)
+			return dangling == (len(names) == 0)
+		}) &&
+		filters.matchNames(names...) &&
+		filters.matchCreated(image.Created)
+}
+
+// showsAll tells whether the filters select containers by their state, which
+// lists all of them rather than the running ones.
+func (filters Filters) showsAll() bool {
+	return len(filters["status"]) > 0 || len(filters["exited"]) > 0
+}
@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the functions available to the templates of -format,
+// e.g. {{join .Tags ", "}} or {{truncate .ID 12}}.
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		buf, err := json.Marshal(v)
+		return string(buf), err
+	},
+	"join":     strings.Join,
+	"truncate": utils.Trunc,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+}
+
+// parseFormat parses the template given to -format, nil if there is none.
+func parseFormat(format string) (*template.Template, error) {
+	if format == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid format: %s", err)
+	}
+	return tmpl, nil
+}
+
+// formatOutput writes v to out with tmpl, on a line of its own.
+func formatOutput(out io.Writer, tmpl *template.Template, v interface{}) error {
+	if err := tmpl.Execute(out, v); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out)
+	return err
+}
@@ -8,19 +8,82 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
+// GraphDriverName is the name of the storage driver used by the runtime.
+// When empty, the driver the runtime was created with is used.
+var GraphDriverName string
+
+const DefaultGraphDriver = "aufs"
+
+// GraphDriver is the interface implemented by the backends which store the
+// filesystem layers of images and containers (aufs, ...).
+// Layers are ordered from the top-most to the base one, and each driver keeps
+// them in its own format. Archives going in and out of a driver are always in
+// the AUFS format, where deleted files are recorded as .wh.<name> whiteouts.
+type GraphDriver interface {
+	// Name returns the name under which the driver was registered.
+	Name() string
+	// Create creates the directory layer and unpacks data into it, if any.
+	Create(layer string, data Archive) error
+	// Mount assembles layers and the read-write layer rw at target.
+	Mount(layers []string, rw, target string) error
+	// Unmount releases target, keeping the changes made there in rw.
+	Unmount(layers []string, rw, target string) error
+	// Mounted tells whether target is currently mounted.
+	Mounted(target string) (bool, error)
+	// Diff returns an archive of the changes recorded in rw.
+	// target is where rw is mounted, if it is.
+	Diff(layers []string, rw, target string) (Archive, error)
+	// Changes lists the changes recorded in rw.
+	Changes(layers []string, rw, target string) ([]Change, error)
+	// Size returns the size of the changes recorded in rw.
+	Size(layers []string, rw, target string) (int64, error)
+}
+
+type graphDriverInitFunc func() (GraphDriver, error)
+
+var graphDrivers = make(map[string]graphDriverInitFunc)
+
+func registerGraphDriver(name string, initFunc graphDriverInitFunc) {
+	if _, exists := graphDrivers[name]; exists {
+		panic(fmt.Sprintf("Storage driver %s registered twice", name))
+	}
+	graphDrivers[name] = initFunc
+}
+
+// GraphDrivers returns the sorted names of the available storage drivers.
+func GraphDrivers() []string {
+	var names []string
+	for name := range graphDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newGraphDriver(name string) (GraphDriver, error) {
+	initFunc, exists := graphDrivers[name]
+	if !exists {
+		return nil, fmt.Errorf("Unknown storage driver: %s", name)
+	}
+	return initFunc()
+}
+
 // A Graph is a store for versioned filesystem images and the relationship between them.
 type Graph struct {
 	Root    string
 	idIndex *utils.TruncIndex
+	driver  GraphDriver
 }
 
-// NewGraph instantiates a new graph at the given root path in the filesystem.
+// NewGraph instantiates a new graph at the given root path in the filesystem,
+// which layers are stored by driver.
 // `root` will be created if it doesn't exist.
-func NewGraph(root string) (*Graph, error) {
+func NewGraph(root string, driver GraphDriver) (*Graph, error) {
 	abspath, err := filepath.Abs(root)
 	if err != nil {
 		return nil, err
@@ -32,6 +95,7 @@ func NewGraph(root string) (*Graph, error) {
 	graph := &Graph{
 		Root:    abspath,
 		idIndex: utils.NewTruncIndex(),
+		driver:  driver,
 	}
 	if err := graph.restore(); err != nil {
 		return nil, err
@@ -130,7 +194,7 @@ func (graph *Graph) Register(jsonData []byte, layerData Archive, img *Image) err
 	if err != nil {
 		return fmt.Errorf("Mktemp failed: %s", err)
 	}
-	if err := StoreImage(img, jsonData, layerData, tmp); err != nil {
+	if err := StoreImage(img, jsonData, layerData, tmp, graph.driver); err != nil {
 		return err
 	}
 	// Commit
@@ -146,7 +210,7 @@ func (graph *Graph) Register(jsonData []byte, layerData Archive, img *Image) err
 //   The archive is stored on disk and will be automatically deleted as soon as has been read.
 //   If output is not nil, a human-readable progress bar will be written to it.
 //   FIXME: does this belong in Graph? How about MktempFile, let the caller use it for archives?
-func (graph *Graph) TempLayerArchive(id string, compression Compression, sf *utils.StreamFormatter, output io.Writer) (*TempArchive, error) {
+func (graph *Graph) TempLayerArchive(id string, sf *utils.StreamFormatter, output io.Writer) (*TempArchive, error) {
 	image, err := graph.Get(id)
 	if err != nil {
 		return nil, err
@@ -155,7 +219,7 @@ func (graph *Graph) TempLayerArchive(id string, compression Compression, sf *uti
 	if err != nil {
 		return nil, err
 	}
-	archive, err := image.TarLayer(compression)
+	archive, err := image.TarLayer()
 	if err != nil {
 		return nil, err
 	}
@@ -179,7 +243,8 @@ func (graph *Graph) Mktemp(id string) (string, error) {
 
 // getDockerInitLayer returns the path of a layer containing a mountpoint suitable
 // for bind-mounting dockerinit into the container. The mountpoint is simply an
-// empty file at /.dockerinit
+// empty file at /.dockerinit, next to the one of the exit status file at
+// /.dockerexit
 //
 // This extra layer is used by all containers as the top-most ro layer. It protects
 // the container from unwanted side-effects on the rw layer.
@@ -201,6 +266,7 @@ func (graph *Graph) getDockerInitLayer() (string, error) {
 		"/proc":            "dir",
 		"/sys":             "dir",
 		"/.dockerinit":     "file",
+		"/.dockerexit":     "file",
 		"/etc/resolv.conf": "file",
 		// "var/run": "dir",
 		// "var/lock": "dir",
@@ -235,7 +301,7 @@ func (graph *Graph) getDockerInitLayer() (string, error) {
 
 func (graph *Graph) tmp() (*Graph, error) {
 	// Changed to _tmp from :tmp:, because it messed with ":" separators in aufs branch syntax...
-	return NewGraph(path.Join(graph.Root, "_tmp"))
+	return NewGraph(path.Join(graph.Root, "_tmp"), graph.driver)
 }
 
 // Check if given error is "not empty".
@@ -145,7 +145,7 @@ func TestMount(t *testing.T) {
 	}
 	// FIXME: test for mount contents
 	defer func() {
-		if err := Unmount(rootfs); err != nil {
+		if err := image.Unmount(rootfs, rw); err != nil {
 			t.Error(err)
 		}
 	}()
@@ -290,7 +290,15 @@ func tempGraph(t *testing.T) *Graph {
 	if err != nil {
 		t.Fatal(err)
 	}
-	graph, err := NewGraph(tmp)
+	driverName := GraphDriverName
+	if driverName == "" {
+		driverName = DefaultGraphDriver
+	}
+	driver, err := newGraphDriver(driverName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := NewGraph(tmp, driver)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -312,6 +320,7 @@ func fakeTar() (io.Reader, error) {
 	for _, name := range []string{"/etc/postgres/postgres.conf", "/etc/passwd", "/var/log/postgres/postgres.conf"} {
 		hdr := new(tar.Header)
 		hdr.Size = int64(len(content))
+		hdr.Mode = 0600
 		hdr.Name = name
 		if err := tw.WriteHeader(hdr); err != nil {
 			return nil, err
@@ -0,0 +1,183 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"time"
+)
+
+// HealthConfig describes the command run periodically in a container to
+// check that it works. A Test of ["NONE"] disables the check of the image.
+type HealthConfig struct {
+	Test     []string
+	Interval int // in seconds
+	Timeout  int // in seconds
+	Retries  int
+}
+
+// Health is the outcome of the health checks of a running container.
+type Health struct {
+	Status        string
+	FailingStreak int
+	Log           []*HealthResult
+}
+
+// HealthResult is the outcome of one run of a health check.
+type HealthResult struct {
+	Start    time.Time
+	End      time.Time
+	ExitCode int
+	Output   string
+}
+
+const (
+	healthStarting  = "starting"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 30 * time.Second
+	defaultHealthRetries  = 3
+
+	// Only the last results and the beginning of their output are kept
+	maxHealthLog    = 5
+	maxHealthOutput = 4096
+)
+
+// enabled tells whether config asks for a health check to be run.
+func (config *HealthConfig) enabled() bool {
+	return config != nil && len(config.Test) > 0 && config.Test[0] != "NONE"
+}
+
+// startHealthcheck runs the health check of the container, if it has one,
+// until its process exits. The status of a container adopted from a
+// previous daemon is kept.
+func (container *Container) startHealthcheck() {
+	config := container.Config.Healthcheck
+	if !config.enabled() {
+		container.State.setHealth(nil)
+		return
+	}
+	if container.State.health() == nil {
+		container.State.setHealth(&Health{Status: healthStarting})
+	}
+	container.healthStop = make(chan struct{})
+	go container.monitorHealth(config, container.healthStop)
+}
+
+// stopHealthcheck stops the health check started by startHealthcheck.
+func (container *Container) stopHealthcheck() {
+	if container.healthStop != nil {
+		close(container.healthStop)
+		container.healthStop = nil
+	}
+}
+
+func (container *Container) monitorHealth(config *HealthConfig, stop chan struct{}) {
+	interval := defaultHealthInterval
+	if config.Interval > 0 {
+		interval = time.Duration(config.Interval) * time.Second
+	}
+	timeout := defaultHealthTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+	retries := defaultHealthRetries
+	if config.Retries > 0 {
+		retries = config.Retries
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+		// A frozen container can't answer
+		container.State.Lock()
+		paused := container.State.Paused
+		container.State.Unlock()
+		if paused {
+			continue
+		}
+		result := container.probe(config.Test, timeout)
+		select {
+		case <-stop:
+			// The check failed because the container exited
+			return
+		default:
+		}
+		container.updateHealth(result, retries)
+	}
+}
+
+// probe runs test in the container, and fails after timeout.
+func (container *Container) probe(test []string, timeout time.Duration) *HealthResult {
+	result := &HealthResult{Start: time.Now()}
+	defer func() { result.End = time.Now() }()
+
+	e, err := newExec(container, &ExecConfig{Cmd: test})
+	if err != nil {
+		result.ExitCode = -1
+		result.Output = err.Error()
+		return result
+	}
+
+	output := &bytes.Buffer{}
+	if err := e.Start(nil, output, output); err != nil {
+		result.ExitCode = -1
+		result.Output = err.Error()
+		return result
+	}
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- e.Wait()
+	}()
+	select {
+	case result.ExitCode = <-exitCode:
+		result.Output = output.String()
+	case <-time.After(timeout):
+		if err := e.Kill(); err != nil {
+			utils.Debugf("%s: Error killing the health check: %s", container.ID, err)
+		}
+		result.ExitCode = -1
+		result.Output = fmt.Sprintf("Health check exceeded its timeout of %s", timeout)
+	}
+	if len(result.Output) > maxHealthOutput {
+		result.Output = result.Output[:maxHealthOutput]
+	}
+	return result
+}
+
+// updateHealth records result. The container becomes unhealthy after
+// retries consecutive failures, and healthy again after one success.
+// The health of the state is replaced rather than changed, as its readers
+// don't take the lock of the state.
+func (container *Container) updateHealth(result *HealthResult, retries int) {
+	container.State.Lock()
+	defer container.State.Unlock()
+	health := container.State.health()
+	if health == nil {
+		return
+	}
+	previous := health.Status
+	health.Log = append(health.Log, result)
+	if len(health.Log) > maxHealthLog {
+		health.Log = health.Log[len(health.Log)-maxHealthLog:]
+	}
+
+	if result.ExitCode == 0 {
+		health.FailingStreak = 0
+		health.Status = healthHealthy
+	} else if health.FailingStreak++; health.FailingStreak >= retries {
+		health.Status = healthUnhealthy
+	}
+	container.State.setHealth(health)
+	if health.Status == previous {
+		return
+	}
+	container.ToDisk()
+	if container.runtime != nil && container.runtime.srv != nil {
+		container.runtime.srv.LogEvent("health_status: "+health.Status, container.ShortID(), container.runtime.repositories.ImageName(container.Image))
+	}
+}
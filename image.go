@@ -72,7 +72,7 @@ func LoadImage(root string) (*Image, error) {
 	return img, nil
 }
 
-func StoreImage(img *Image, jsonData []byte, layerData Archive, root string) error {
+func StoreImage(img *Image, jsonData []byte, layerData Archive, root string, driver GraphDriver) error {
 	// Check that root doesn't already exist
 	if _, err := os.Stat(root); err == nil {
 		return fmt.Errorf("Image %s already exists", img.ID)
@@ -80,21 +80,10 @@ func StoreImage(img *Image, jsonData []byte, layerData Archive, root string) err
 		return err
 	}
 	// Store the layer
-	layer := layerPath(root)
-	if err := os.MkdirAll(layer, 0755); err != nil {
+	if err := driver.Create(layerPath(root), layerData); err != nil {
 		return err
 	}
 
-	// If layerData is not nil, unpack it into the new layer
-	if layerData != nil {
-		start := time.Now()
-		utils.Debugf("Start untar layer")
-		if err := Untar(layerData, layer); err != nil {
-			return err
-		}
-		utils.Debugf("Untar time: %vs\n", time.Now().Sub(start).Seconds())
-	}
-
 	// If raw json is provided, then use it
 	if jsonData != nil {
 		return ioutil.WriteFile(jsonPath(root), jsonData, 0600)
@@ -136,6 +125,23 @@ func jsonPath(root string) string {
 	return path.Join(root, "json")
 }
 
+// untarLayer creates the directory layer and unpacks layerData into it, if
+// not nil.
+func untarLayer(layer string, layerData Archive) error {
+	if err := os.MkdirAll(layer, 0755); err != nil {
+		return err
+	}
+	if layerData != nil {
+		start := time.Now()
+		utils.Debugf("Start untar layer")
+		if err := Untar(layerData, layer); err != nil {
+			return err
+		}
+		utils.Debugf("Untar time: %vs\n", time.Now().Sub(start).Seconds())
+	}
+	return nil
+}
+
 func MountAUFS(ro []string, rw string, target string) error {
 	// FIXME: Now mount the layers
 	rwBranch := fmt.Sprintf("%v=rw", rw)
@@ -162,16 +168,19 @@ func MountAUFS(ro []string, rw string, target string) error {
 }
 
 // TarLayer returns a tar archive of the image's filesystem layer.
-func (image *Image) TarLayer(compression Compression) (Archive, error) {
+func (image *Image) TarLayer() (Archive, error) {
 	layerPath, err := image.layer()
 	if err != nil {
 		return nil, err
 	}
-	return Tar(layerPath, compression)
+	return image.graph.driver.Diff(nil, layerPath, "")
 }
 
 func (image *Image) Mount(root, rw string) error {
-	if mounted, err := Mounted(root); err != nil {
+	if image.graph == nil {
+		return fmt.Errorf("Can't mount unregistered image")
+	}
+	if mounted, err := image.graph.driver.Mounted(root); err != nil {
 		return err
 	} else if mounted {
 		return fmt.Errorf("%s is already mounted", root)
@@ -184,21 +193,79 @@ func (image *Image) Mount(root, rw string) error {
 	if err := os.Mkdir(root, 0755); err != nil && !os.IsExist(err) {
 		return err
 	}
-	if err := os.Mkdir(rw, 0755); err != nil && !os.IsExist(err) {
+	if _, err := os.Stat(rw); os.IsNotExist(err) {
+		if err := image.graph.driver.Create(rw, nil); err != nil {
+			return err
+		}
+	} else if err != nil {
 		return err
 	}
-	if err := MountAUFS(layers, rw, root); err != nil {
+	if err := image.graph.driver.Mount(layers, rw, root); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (image *Image) Changes(rw string) ([]Change, error) {
+// labels returns the labels of the containers created from the image.
+func (image *Image) labels() map[string]string {
+	if image.Config == nil {
+		return nil
+	}
+	return image.Config.Labels
+}
+
+func (image *Image) Unmount(root, rw string) error {
+	if image.graph == nil {
+		return fmt.Errorf("Can't unmount unregistered image")
+	}
+	layers, err := image.layers()
+	if err != nil {
+		return err
+	}
+	return image.graph.driver.Unmount(layers, rw, root)
+}
+
+func (image *Image) Mounted(root string) (bool, error) {
+	if image.graph == nil {
+		return false, fmt.Errorf("Can't lookup mounts of unregistered image")
+	}
+	return image.graph.driver.Mounted(root)
+}
+
+// Diff returns an archive of the changes made in rw on top of the image,
+// mounted at root or not.
+func (image *Image) Diff(root, rw string) (Archive, error) {
+	if image.graph == nil {
+		return nil, fmt.Errorf("Can't diff unregistered image")
+	}
+	layers, err := image.layers()
+	if err != nil {
+		return nil, err
+	}
+	return image.graph.driver.Diff(layers, rw, root)
+}
+
+func (image *Image) Changes(root, rw string) ([]Change, error) {
+	if image.graph == nil {
+		return nil, fmt.Errorf("Can't lookup changes of unregistered image")
+	}
 	layers, err := image.layers()
 	if err != nil {
 		return nil, err
 	}
-	return Changes(layers, rw)
+	return image.graph.driver.Changes(layers, rw, root)
+}
+
+// ChangesSize returns the size of the changes made in rw on top of the image.
+func (image *Image) ChangesSize(root, rw string) (int64, error) {
+	if image.graph == nil {
+		return 0, fmt.Errorf("Can't lookup size of unregistered image")
+	}
+	layers, err := image.layers()
+	if err != nil {
+		return 0, err
+	}
+	return image.graph.driver.Size(layers, rw, root)
 }
 
 func (image *Image) ShortID() string {
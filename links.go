@@ -0,0 +1,160 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// link gives a container access to another one, its target, under an alias.
+type link struct {
+	alias  string
+	target *Container
+}
+
+// resolveLinks looks up the targets of the links given to run -link. They
+// must be running, with networking enabled.
+func (container *Container) resolveLinks(specs []string) ([]link, error) {
+	var links []link
+	for _, spec := range specs {
+		name, alias, err := parseLink(spec)
+		if err != nil {
+			return nil, err
+		}
+		target := container.runtime.Get(name)
+		if target == nil {
+			return nil, fmt.Errorf("Impossible to link to %s: no such container", name)
+		}
+		if target == container {
+			return nil, fmt.Errorf("Impossible to link container %s to itself", name)
+		}
+		if !target.State.Running {
+			return nil, fmt.Errorf("Impossible to link to %s: it is not running", name)
+		}
+		if target.Config.NetworkDisabled {
+			return nil, fmt.Errorf("Impossible to link to %s: its networking is disabled", name)
+		}
+		links = append(links, link{alias: alias, target: target})
+	}
+	return links, nil
+}
+
+// env returns the environment variables describing the target of l to the
+// container name, e.g. DB_PORT_5432_TCP_ADDR for the port 5432 of the alias
+// db. Only the ports the target exposes are described.
+func (l link) env(name string) []string {
+	prefix := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(l.alias))
+	ip := l.target.NetworkSettings.IPAddress
+	env := []string{fmt.Sprintf("%s_NAME=/%s/%s", prefix, name, l.alias)}
+	for _, proto := range []string{"Tcp", "Udp"} {
+		var ports []int
+		for private := range l.target.NetworkSettings.PortMapping[proto] {
+			if port, err := strconv.Atoi(private); err == nil {
+				ports = append(ports, port)
+			}
+		}
+		sort.Ints(ports)
+		for _, port := range ports {
+			url := fmt.Sprintf("%s://%s:%d", strings.ToLower(proto), ip, port)
+			key := fmt.Sprintf("%s_PORT_%d_%s", prefix, port, strings.ToUpper(proto))
+			// The lowest port, TCP first, is the main one
+			if len(env) == 1 {
+				env = append(env, prefix+"_PORT="+url)
+			}
+			env = append(env,
+				key+"="+url,
+				key+"_ADDR="+ip,
+				key+"_PORT="+strconv.Itoa(port),
+				key+"_PROTO="+strings.ToLower(proto),
+			)
+		}
+	}
+	return env
+}
+
+// linkOrder sorts containers so that the targets of their links among them
+// come first, for them to be started in this order.
+func (runtime *Runtime) linkOrder(containers []*Container) []*Container {
+	pending := make(map[string]bool)
+	for _, container := range containers {
+		pending[container.ID] = true
+	}
+	var sorted []*Container
+	visited := make(map[string]bool)
+	var visit func(container *Container)
+	visit = func(container *Container) {
+		if visited[container.ID] {
+			return
+		}
+		visited[container.ID] = true
+		if hostConfig, err := container.ReadHostConfig(); err == nil {
+			for _, spec := range hostConfig.Links {
+				if name, _, err := parseLink(spec); err == nil {
+					if target := runtime.Get(name); target != nil && pending[target.ID] {
+						visit(target)
+					}
+				}
+			}
+		}
+		sorted = append(sorted, container)
+	}
+	for _, container := range containers {
+		visit(container)
+	}
+	return sorted
+}
+
+// setupLinks resolves the links of the container before it starts, and
+// sets up their environment variables. The aliases are added to its hosts
+// file by writeHosts.
+func (container *Container) setupLinks(specs []string) ([]link, error) {
+	links, err := container.resolveLinks(specs)
+	if err != nil {
+		return nil, err
+	}
+	name := container.Name
+	if name == "" {
+		name = container.ShortID()
+	}
+	container.linkEnv = nil
+	for _, l := range links {
+		container.linkEnv = append(container.linkEnv, l.env(name)...)
+	}
+	return links, nil
+}
+
+// updateLinks rewrites the hosts files of the running containers linked to
+// target, whose address changes when it is restarted. Their environment
+// keeps the previous one until they are restarted too.
+func (runtime *Runtime) updateLinks(target *Container) {
+	for _, container := range runtime.List() {
+		if container == target || !container.State.Running {
+			continue
+		}
+		hostConfig, err := container.ReadHostConfig()
+		if err != nil {
+			continue
+		}
+		var links []link
+		linked := false
+		for _, spec := range hostConfig.Links {
+			name, alias, err := parseLink(spec)
+			if err != nil {
+				continue
+			}
+			t := runtime.Get(name)
+			if t == nil || !t.State.Running || t.Config.NetworkDisabled {
+				continue
+			}
+			linked = linked || t == target
+			links = append(links, link{alias: alias, target: t})
+		}
+		if linked {
+			if err := container.writeHosts(links); err != nil {
+				utils.Debugf("Error updating the links of %s: %s", container.ID, err)
+			}
+		}
+	}
+}
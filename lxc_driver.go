@@ -0,0 +1,142 @@
+package docker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerExecDriver("lxc", func(root string) (ExecDriver, error) {
+		return &lxcDriver{}, nil
+	})
+}
+
+// lxcDriver runs containers with the lxc userland tools.
+type lxcDriver struct {
+}
+
+func (d *lxcDriver) Name() string {
+	return "lxc"
+}
+
+func (d *lxcDriver) Command(container *Container, hostConfig *HostConfig, args []string) (*exec.Cmd, error) {
+	if err := container.generateLXCConfig(hostConfig); err != nil {
+		return nil, err
+	}
+	params := []string{
+		"-n", container.ID,
+		"-f", container.lxcConfigPath(),
+		"--",
+		"/.dockerinit",
+	}
+	params = append(params, args...)
+	return exec.Command("lxc-start", params...), nil
+}
+
+func (d *lxcDriver) Run(container *Container, cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+// Exec runs dockerinit from inside the container, lxc-attach takes care of
+// its control groups and capabilities.
+func (d *lxcDriver) Exec(container *Container, args []string) (*exec.Cmd, error) {
+	return exec.Command("lxc-attach", append([]string{"-n", container.ID, "--", "/.dockerinit"}, args...)...), nil
+}
+
+func (d *lxcDriver) Pause(container *Container) error {
+	if output, err := exec.Command("lxc-freeze", "-n", container.ID).CombinedOutput(); err != nil {
+		return fmt.Errorf("Error pausing container %s: %s (%s)", container.ID, err, output)
+	}
+	return nil
+}
+
+func (d *lxcDriver) Unpause(container *Container) error {
+	if output, err := exec.Command("lxc-unfreeze", "-n", container.ID).CombinedOutput(); err != nil {
+		return fmt.Errorf("Error unpausing container %s: %s (%s)", container.ID, err, output)
+	}
+	return nil
+}
+
+func (d *lxcDriver) Kill(container *Container, sig int) error {
+	output, err := exec.Command("lxc-kill", "-n", container.ID, strconv.Itoa(sig)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("lxc-kill failed: %s (%s)", err, output)
+	}
+	return nil
+}
+
+func (d *lxcDriver) Info(container *Container) (*ExecInfo, error) {
+	output, err := exec.Command("lxc-info", "-n", container.ID).CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	info := &ExecInfo{}
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "state":
+			info.Running = strings.TrimSpace(parts[1]) == "RUNNING"
+		case "pid":
+			info.Pid, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+		}
+	}
+	return info, nil
+}
+
+func (d *lxcDriver) Pids(container *Container) ([]int, error) {
+	output, err := exec.Command("lxc-ps", "--name", container.ID, "--", "-o", "pid").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("Error trying to use lxc-ps: %s (%s)", err, output)
+	}
+	var pids []int
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	// Skip the title line
+	scanner.Scan()
+	for scanner.Scan() {
+		// Each line is made of the container id followed by the pid
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing lxc-ps output: %s", err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// lxc-start cleans up after itself when the container exits.
+func (d *lxcDriver) Terminate(container *Container) error {
+	return nil
+}
+
+func (container *Container) generateLXCConfig(hostConfig *HostConfig) error {
+	fo, err := os.Create(container.lxcConfigPath())
+	if err != nil {
+		return err
+	}
+	defer fo.Close()
+	if err := LxcTemplateCompiled.Execute(fo, container); err != nil {
+		return err
+	}
+	if hostConfig != nil {
+		if err := LxcHostConfigTemplateCompiled.Execute(fo, hostConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (container *Container) lxcConfigPath() string {
+	return path.Join(container.root, "config.lxc")
+}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"strings"
 	"text/template"
 )
 
@@ -34,6 +35,10 @@ lxc.rootfs = {{$ROOTFS}}
 # available)
 lxc.pts = 1024
 
+# a /dev of its own on a tmpfs, filled each time the container starts, so
+# that the devices given to run -device stay out of the root filesystem
+lxc.autodev = 1
+
 # disable the main console
 lxc.console = none
 
@@ -67,8 +72,8 @@ lxc.cgroup.devices.allow = c 5:2 rwm
 # tuntap
 lxc.cgroup.devices.allow = c 10:200 rwm
 
-# fuse
-#lxc.cgroup.devices.allow = c 10:229 rwm
+# other devices, such as fuse, are given with run -device,
+# see LxcHostConfigTemplate
 
 # rtc
 #lxc.cgroup.devices.allow = c 254:0 rwm
@@ -81,16 +86,20 @@ lxc.mount.entry = proc {{$ROOTFS}}/proc proc nosuid,nodev,noexec 0 0
 #  WARNING: sysfs is a known attack vector and should probably be disabled
 #           if your userspace allows it. eg. see http://bit.ly/T9CkqJ
 lxc.mount.entry = sysfs {{$ROOTFS}}/sys sysfs nosuid,nodev,noexec 0 0
-lxc.mount.entry = devpts {{$ROOTFS}}/dev/pts devpts newinstance,ptmxmode=0666,nosuid,noexec 0 0
+lxc.mount.entry = devpts {{$ROOTFS}}/dev/pts devpts newinstance,ptmxmode=0666,nosuid,noexec,create=dir 0 0
 #lxc.mount.entry = varrun {{$ROOTFS}}/var/run tmpfs mode=755,size=4096k,nosuid,nodev,noexec 0 0
 #lxc.mount.entry = varlock {{$ROOTFS}}/var/lock tmpfs size=1024k,nosuid,nodev,noexec 0 0
-lxc.mount.entry = shm {{$ROOTFS}}/dev/shm tmpfs size=65536k,nosuid,nodev,noexec 0 0
+lxc.mount.entry = shm {{$ROOTFS}}/dev/shm tmpfs size=65536k,nosuid,nodev,noexec,create=dir 0 0
 
 # Inject docker-init
 lxc.mount.entry = {{.SysInitPath}} {{$ROOTFS}}/.dockerinit none bind,ro 0 0
+{{if not .Config.Tty}}
+lxc.mount.entry = {{.ExitStatusPath}} {{$ROOTFS}}/.dockerexit none bind,rw 0 0
+{{end}}
 
-# In order to get a working DNS environment, mount bind (ro) the host's /etc/resolv.conf into the container
+# In order to get a working DNS environment, mount bind (ro) the resolv.conf and hosts generated for the container
 lxc.mount.entry = {{.ResolvConfPath}} {{$ROOTFS}}/etc/resolv.conf none bind,ro 0 0
+lxc.mount.entry = {{.HostsPath}} {{$ROOTFS}}/etc/hosts none bind,ro 0 0
 {{if .Volumes}}
 {{ $rw := .VolumesRW }}
 {{range $virtualPath, $realPath := .Volumes}}
@@ -105,7 +114,10 @@ lxc.mount.entry = {{$realPath}} {{$ROOTFS}}/{{$virtualPath}} none bind,{{ if ind
 #  (Note: 'lxc.cap.keep' is coming soon and should replace this under the
 #         security principle 'deny all unless explicitly permitted', see
 #         http://sourceforge.net/mailarchive/message.php?msg_id=31054627 )
-lxc.cap.drop = audit_control audit_write mac_admin mac_override mknod setfcap setpcap sys_admin sys_boot sys_module sys_nice sys_pacct sys_rawio sys_resource sys_time sys_tty_config
+# The defaults are changed by -cap-add and -cap-drop
+{{with $caps := lxcDroppedCapabilities .Config}}
+lxc.cap.drop = {{$caps}}
+{{end}}
 {{end}}
 
 # limits
@@ -119,9 +131,38 @@ lxc.cgroup.memory.memsw.limit_in_bytes = {{$memSwap}}
 {{if .Config.CpuShares}}
 lxc.cgroup.cpu.shares = {{.Config.CpuShares}}
 {{end}}
+{{if .Config.CpusetCpus}}
+lxc.cgroup.cpuset.cpus = {{.Config.CpusetCpus}}
+{{end}}
+{{if .Config.CpusetMems}}
+lxc.cgroup.cpuset.mems = {{.Config.CpusetMems}}
+{{end}}
+{{if .Config.BlkioWeight}}
+lxc.cgroup.blkio.weight = {{.Config.BlkioWeight}}
+{{end}}
+{{range $device := .Config.BlkioReadBps}}
+lxc.cgroup.blkio.throttle.read_bps_device = {{throttleDevice $device}}
+{{end}}
+{{range $device := .Config.BlkioWriteBps}}
+lxc.cgroup.blkio.throttle.write_bps_device = {{throttleDevice $device}}
+{{end}}
+{{if .Config.PidsLimit}}
+lxc.cgroup.pids.max = {{.Config.PidsLimit}}
+{{end}}
 `
 
 const LxcHostConfigTemplate = `
+{{if .ReadonlyRootfs}}
+lxc.rootfs.options = ro
+{{end}}
+# relative to the root filesystem
+{{range $tmpfsPath, $options := .Tmpfs}}
+lxc.mount.entry = tmpfs {{trimPrefix $tmpfsPath "/"}} tmpfs {{tmpfsOptions $options}} 0 0
+{{end}}
+{{range $device := .Devices}}
+lxc.cgroup.devices.allow = {{deviceCgroupRule $device}}
+lxc.mount.entry = {{$device.PathOnHost}} {{trimPrefix $device.PathInContainer "/"}} none bind,create=file 0 0
+{{end}}
 {{if .LxcConf}}
 {{range $pair := .LxcConf}}
 {{$pair.Key}} = {{$pair.Value}}
@@ -144,7 +185,12 @@ func getMemorySwap(config *Config) int64 {
 func init() {
 	var err error
 	funcMap := template.FuncMap{
-		"getMemorySwap": getMemorySwap,
+		"getMemorySwap":          getMemorySwap,
+		"throttleDevice":         throttleDevice,
+		"deviceCgroupRule":       deviceCgroupRule,
+		"tmpfsOptions":           tmpfsOptions,
+		"trimPrefix":             strings.TrimPrefix,
+		"lxcDroppedCapabilities": lxcDroppedCapabilities,
 	}
 	LxcTemplateCompiled, err = template.New("lxc").Funcs(funcMap).Parse(LxcTemplate)
 	if err != nil {
@@ -0,0 +1,15 @@
+package docker
+
+import "errors"
+
+func setupNativeContainer() error {
+	return errors.New("the native execution driver is not implemented on darwin")
+}
+
+func dropCapabilities(names []string) error {
+	return errors.New("dropping capabilities is not implemented on darwin")
+}
+
+func nativeExec(id, pid string, args []string) error {
+	return errors.New("the native execution driver is not implemented on darwin")
+}
@@ -0,0 +1,539 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	registerExecDriver("native", func(root string) (ExecDriver, error) {
+		// Exec enters the namespaces of the containers with it
+		if _, err := exec.LookPath("nsenter"); err != nil {
+			return nil, fmt.Errorf("The native execution driver needs nsenter, from util-linux: %s", err)
+		}
+		return &nativeDriver{syncPipes: make(map[string]*os.File)}, nil
+	})
+}
+
+// nativeContainer describes the container to the dockerinit process started
+// by the native driver. It is sent over the sync pipe once the parent has
+// set up the cgroups and the network of the new process.
+type nativeContainer struct {
+	Hostname       string
+	Rootfs         string
+	SysInitPath    string
+	ResolvConfPath string
+	HostsPath      string
+	ExitStatusPath string
+	Volumes        map[string]string
+	VolumesRW      map[string]bool
+	ReadonlyRootfs bool
+	Tmpfs          map[string]string
+	Devices        []DeviceMapping
+	Network        *nativeNetwork
+	// Removed from every capability set, see droppedCapabilities
+	DropCapabilities []string
+}
+
+type nativeNetwork struct {
+	Interface   string // name of the veth peer moved into the container
+	IPAddress   string
+	IPPrefixLen int
+	Gateway     string
+	Mtu         int
+}
+
+// nativeDriver runs containers in new namespaces created straight from Go,
+// without depending on the lxc userland tools.
+type nativeDriver struct {
+	sync.Mutex
+	syncPipes map[string]*os.File
+}
+
+func (d *nativeDriver) Name() string {
+	return "native"
+}
+
+func (d *nativeDriver) Command(container *Container, hostConfig *HostConfig, args []string) (*exec.Cmd, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(container.SysInitPath, append([]string{nativeInitFlag}, args...)...)
+	cmd.ExtraFiles = []*os.File{r}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET,
+	}
+
+	d.Lock()
+	d.syncPipes[container.ID] = w
+	d.Unlock()
+	return cmd, nil
+}
+
+func (d *nativeDriver) Run(container *Container, cmd *exec.Cmd) error {
+	d.Lock()
+	w := d.syncPipes[container.ID]
+	delete(d.syncPipes, container.ID)
+	d.Unlock()
+	if w == nil {
+		return fmt.Errorf("No sync pipe for container %s", container.ID)
+	}
+	defer w.Close()
+
+	err := cmd.Start()
+	// The child has its own copy of the read end of the pipe
+	cmd.ExtraFiles[0].Close()
+	if err != nil {
+		return err
+	}
+
+	// From here on, the child is blocked until it reads its configuration
+	// from the sync pipe. Closing it without writing makes it exit.
+	abort := func(err error) error {
+		cmd.Process.Kill()
+		cmd.Wait()
+		removeCgroups(container.ID)
+		return err
+	}
+	pid := cmd.Process.Pid
+	if err := setupCgroups(container, pid); err != nil {
+		return abort(err)
+	}
+	nc := &nativeContainer{
+		Hostname:       container.Config.Hostname,
+		Rootfs:         container.RootfsPath(),
+		SysInitPath:    container.SysInitPath,
+		ResolvConfPath: container.ResolvConfPath,
+		HostsPath:      container.HostsPath,
+		Volumes:        container.Volumes,
+		VolumesRW:      container.VolumesRW,
+
+		DropCapabilities: droppedCapabilities(container.Config),
+	}
+	if !container.Config.Tty {
+		nc.ExitStatusPath = container.ExitStatusPath()
+	}
+	if container.hostConfig != nil {
+		nc.ReadonlyRootfs = container.hostConfig.ReadonlyRootfs
+		nc.Tmpfs = container.hostConfig.Tmpfs
+		nc.Devices = container.hostConfig.Devices
+	}
+	if nc.Hostname == "" {
+		nc.Hostname = container.ShortID()
+	}
+	if !container.Config.NetworkDisabled {
+		network, err := d.setupNetwork(container, pid)
+		if err != nil {
+			return abort(err)
+		}
+		nc.Network = network
+	}
+	if err := json.NewEncoder(w).Encode(nc); err != nil {
+		return abort(err)
+	}
+	return nil
+}
+
+// setupNetwork creates a veth pair, attaches one end to the bridge and
+// moves the other one into the network namespace of pid.
+func (d *nativeDriver) setupNetwork(container *Container, pid int) (*nativeNetwork, error) {
+	name := "veth" + container.ID[:7]
+	peer := "vethp" + container.ID[:7]
+	if _, err := ip("link", "add", "name", name, "type", "veth", "peer", "name", peer); err != nil {
+		return nil, err
+	}
+	for _, args := range [][]string{
+		{"link", "set", name, "master", container.NetworkSettings.Bridge},
+		{"link", "set", name, "mtu", "1500"},
+		{"link", "set", name, "up"},
+		{"link", "set", peer, "netns", fmt.Sprint(pid)},
+	} {
+		if _, err := ip(args...); err != nil {
+			ip("link", "del", name)
+			return nil, err
+		}
+	}
+	return &nativeNetwork{
+		Interface:   peer,
+		IPAddress:   container.NetworkSettings.IPAddress,
+		IPPrefixLen: container.NetworkSettings.IPPrefixLen,
+		Gateway:     container.NetworkSettings.Gateway,
+		Mtu:         1500,
+	}, nil
+}
+
+// Exec runs dockerinit on the host first, which joins the control groups of
+// the container and enters its namespaces, see nativeExec.
+func (d *nativeDriver) Exec(container *Container, args []string) (*exec.Cmd, error) {
+	if container.State.Pid == 0 {
+		return nil, fmt.Errorf("Container %s has no process", container.ID)
+	}
+	if caps := droppedCapabilities(container.Config); len(caps) > 0 {
+		args = append([]string{"-dropcaps", strings.Join(caps, ",")}, args...)
+	}
+	return exec.Command(container.SysInitPath, append([]string{nativeExecFlag, container.ID, strconv.Itoa(container.State.Pid)}, args...)...), nil
+}
+
+func (d *nativeDriver) Pause(container *Container) error {
+	return freezeCgroup(container.ID, "FROZEN")
+}
+
+func (d *nativeDriver) Unpause(container *Container) error {
+	return freezeCgroup(container.ID, "THAWED")
+}
+
+func (d *nativeDriver) Kill(container *Container, sig int) error {
+	if container.State.Pid == 0 {
+		return fmt.Errorf("Container %s has no process", container.ID)
+	}
+	return syscall.Kill(container.State.Pid, syscall.Signal(sig))
+}
+
+func (d *nativeDriver) Info(container *Container) (*ExecInfo, error) {
+	pids, err := cgroupPids(container.ID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &ExecInfo{}, nil
+		}
+		return nil, err
+	}
+	info := &ExecInfo{Running: len(pids) > 0}
+	if info.Running {
+		info.Pid = container.State.Pid
+	}
+	return info, nil
+}
+
+func (d *nativeDriver) Pids(container *Container) ([]int, error) {
+	return cgroupPids(container.ID)
+}
+
+// Killing the first process of the container kills all the others along with
+// the namespaces, including the veth pair. Only the cgroups are left behind.
+func (d *nativeDriver) Terminate(container *Container) error {
+	return removeCgroups(container.ID)
+}
+
+// setupNativeContainer runs inside the namespaces created by the native
+// driver, before the usual dockerinit steps. It waits for the configuration
+// sent by the driver, sets up the network, mounts and capabilities, then
+// pivots into the root filesystem of the container.
+func setupNativeContainer() error {
+	syncPipe := os.NewFile(3, "syncpipe")
+	data, err := ioutil.ReadAll(syncPipe)
+	syncPipe.Close()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("The container was not set up by the execution driver")
+	}
+	nc := &nativeContainer{}
+	if err := json.Unmarshal(data, nc); err != nil {
+		return err
+	}
+
+	if err := syscall.Sethostname([]byte(nc.Hostname)); err != nil {
+		return fmt.Errorf("Unable to set hostname: %s", err)
+	}
+	if err := setupNativeNetwork(nc.Network); err != nil {
+		return fmt.Errorf("Unable to set up networking: %s", err)
+	}
+	if err := setupNativeMounts(nc); err != nil {
+		return err
+	}
+	if err := pivotRoot(nc.Rootfs); err != nil {
+		return err
+	}
+	// pivot_root needs to write to the root filesystem, so it becomes
+	// read-only last. The mounts on top of it are not affected.
+	if nc.ReadonlyRootfs {
+		if err := mount("/", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("Unable to remount / read-only: %s", err)
+		}
+	}
+	return dropCapabilities(nc.DropCapabilities)
+}
+
+// dropCapabilities removes the capabilities names from the bounding set of
+// the process, in this order, then from its effective, permitted and
+// inheritable sets.
+func dropCapabilities(names []string) error {
+	header := capHeader{version: linuxCapabilityVersion3}
+	var data [2]capData
+	if _, _, e := syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); e != 0 {
+		return fmt.Errorf("Unable to get the capabilities: %s", e)
+	}
+	for _, name := range names {
+		capability, exists := linuxCapabilities[name]
+		if !exists {
+			return fmt.Errorf("Unknown capability: %s", name)
+		}
+		if _, _, e := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, capability, 0); e != 0 {
+			// Capabilities newer than the kernel are not there anyway
+			if e == syscall.EINVAL {
+				continue
+			}
+			return fmt.Errorf("Unable to drop capability %s: %s", name, e)
+		}
+	}
+	for _, name := range names {
+		capability := linuxCapabilities[name]
+		mask := ^uint32(1 << (capability % 32))
+		d := &data[capability/32]
+		d.effective &= mask
+		d.permitted &= mask
+		d.inheritable &= mask
+	}
+	if _, _, e := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); e != 0 {
+		return fmt.Errorf("Unable to set the capabilities: %s", e)
+	}
+	return nil
+}
+
+// The version of capget(2) and capset(2) with 64 bits capability sets, split
+// in two capData.
+const linuxCapabilityVersion3 = 0x20080522
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// nativeExec runs on the host, as the dockerinit started by Exec. It moves
+// itself into the control groups of the container id, then enters the
+// namespaces of its process pid with nsenter, which runs dockerinit again
+// from inside the container with args.
+func nativeExec(id, pid string, args []string) error {
+	for _, subsystem := range cgroupSubsystems {
+		dir, err := cgroupPath(subsystem, id)
+		if err != nil {
+			continue
+		}
+		if err := writeCgroupFile(dir, "tasks", strconv.Itoa(os.Getpid())); err != nil {
+			return err
+		}
+	}
+	nsenter, err := exec.LookPath("nsenter")
+	if err != nil {
+		return fmt.Errorf("Unable to find nsenter: %s", err)
+	}
+	nsenterArgs := []string{"nsenter", "--target", pid, "--mount", "--uts", "--ipc", "--net", "--pid", "--root", "--", "/.dockerinit"}
+	return syscall.Exec(nsenter, append(nsenterArgs, args...), os.Environ())
+}
+
+// The ip binary of the host is still reachable at this point, the root
+// filesystem of the container does not need one.
+func setupNativeNetwork(network *nativeNetwork) error {
+	if _, err := ip("link", "set", "lo", "up"); err != nil {
+		return err
+	}
+	if network == nil {
+		return nil
+	}
+	for _, args := range [][]string{
+		{"link", "set", network.Interface, "name", "eth0"},
+		{"link", "set", "eth0", "mtu", fmt.Sprint(network.Mtu)},
+		{"addr", "add", fmt.Sprintf("%s/%d", network.IPAddress, network.IPPrefixLen), "dev", "eth0"},
+		{"link", "set", "eth0", "up"},
+		{"route", "add", "default", "via", network.Gateway},
+	} {
+		if _, err := ip(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setupNativeMounts(nc *nativeContainer) error {
+	// Make sure none of our mounts propagate back to the host
+	if err := mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("Unable to make / private: %s", err)
+	}
+	// pivot_root needs the new root to be a mountpoint
+	if err := mount(nc.Rootfs, nc.Rootfs, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("Unable to bind mount %s: %s", nc.Rootfs, err)
+	}
+
+	mounts := []struct {
+		source, target, fstype string
+		flags                  uintptr
+		data                   string
+	}{
+		{"proc", "/proc", "proc", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC, ""},
+		{"sysfs", "/sys", "sysfs", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC, ""},
+		{"tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID | syscall.MS_STRICTATIME, "mode=755"},
+		{"devpts", "/dev/pts", "devpts", syscall.MS_NOSUID | syscall.MS_NOEXEC, "newinstance,ptmxmode=0666"},
+		{"shm", "/dev/shm", "tmpfs", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC, "size=65536k"},
+	}
+	for _, m := range mounts {
+		target := path.Join(nc.Rootfs, m.target)
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		if err := mount(m.source, target, m.fstype, m.flags, m.data); err != nil {
+			return fmt.Errorf("Unable to mount %s on %s: %s", m.source, target, err)
+		}
+	}
+	if err := setupNativeDev(nc); err != nil {
+		return err
+	}
+
+	if err := bindMount(nc.SysInitPath, path.Join(nc.Rootfs, ".dockerinit"), true); err != nil {
+		return err
+	}
+	if err := bindMount(nc.ResolvConfPath, path.Join(nc.Rootfs, "etc/resolv.conf"), true); err != nil {
+		return err
+	}
+	if err := bindMount(nc.HostsPath, path.Join(nc.Rootfs, "etc/hosts"), true); err != nil {
+		return err
+	}
+	if nc.ExitStatusPath != "" {
+		if err := bindMount(nc.ExitStatusPath, path.Join(nc.Rootfs, ".dockerexit"), false); err != nil {
+			return err
+		}
+	}
+	for tmpfsPath, options := range nc.Tmpfs {
+		flags, data := parseMountOptions(tmpfsOptions(options))
+		if err := mount("tmpfs", path.Join(nc.Rootfs, tmpfsPath), "tmpfs", flags, data); err != nil {
+			return fmt.Errorf("Unable to mount tmpfs on %s: %s", tmpfsPath, err)
+		}
+	}
+	for virtualPath, realPath := range nc.Volumes {
+		if err := bindMount(realPath, path.Join(nc.Rootfs, virtualPath), !nc.VolumesRW[virtualPath]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Device nodes of the /dev of every container, see cgroupDevicesAllowed
+var nativeDevices = []struct {
+	name         string
+	major, minor int
+}{
+	{"null", 1, 3},
+	{"zero", 1, 5},
+	{"random", 1, 8},
+	{"urandom", 1, 9},
+	{"tty", 5, 0},
+}
+
+var nativeDevSymlinks = map[string]string{
+	"fd":     "/proc/self/fd",
+	"stdin":  "/proc/self/fd/0",
+	"stdout": "/proc/self/fd/1",
+	"stderr": "/proc/self/fd/2",
+	// Use the ptmx of the new devpts instance
+	"ptmx": "pts/ptmx",
+}
+
+// setupNativeDev fills the tmpfs mounted on /dev, which hides the /dev of
+// the image, with the usual nodes and the devices given to run -device.
+func setupNativeDev(nc *nativeContainer) error {
+	dev := path.Join(nc.Rootfs, "dev")
+	for _, device := range nativeDevices {
+		target := path.Join(dev, device.name)
+		if err := syscall.Mknod(target, syscall.S_IFCHR|0666, device.major<<8|device.minor); err != nil {
+			return fmt.Errorf("Unable to create /dev/%s: %s", device.name, err)
+		}
+		// The umask applies to mknod
+		if err := os.Chmod(target, 0666); err != nil {
+			return err
+		}
+	}
+	for name, target := range nativeDevSymlinks {
+		if err := os.Symlink(target, path.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+	return createDeviceNodes(nc.Rootfs, nc.Devices)
+}
+
+// mountFlags are the options of mount(8) which are flags of mount(2), and
+// whether they set or clear them.
+var mountFlags = map[string]struct {
+	clear bool
+	flag  uintptr
+}{
+	"ro":         {false, syscall.MS_RDONLY},
+	"rw":         {true, syscall.MS_RDONLY},
+	"nosuid":     {false, syscall.MS_NOSUID},
+	"suid":       {true, syscall.MS_NOSUID},
+	"nodev":      {false, syscall.MS_NODEV},
+	"dev":        {true, syscall.MS_NODEV},
+	"noexec":     {false, syscall.MS_NOEXEC},
+	"exec":       {true, syscall.MS_NOEXEC},
+	"noatime":    {false, syscall.MS_NOATIME},
+	"atime":      {true, syscall.MS_NOATIME},
+	"sync":       {false, syscall.MS_SYNCHRONOUS},
+	"async":      {true, syscall.MS_SYNCHRONOUS},
+	"nodiratime": {false, syscall.MS_NODIRATIME},
+	"diratime":   {true, syscall.MS_NODIRATIME},
+}
+
+// parseMountOptions splits comma separated mount options into the flags
+// and the data of mount(2). The last option wins, as with mount(8).
+func parseMountOptions(options string) (uintptr, string) {
+	var flags uintptr
+	var data []string
+	for _, option := range strings.Split(options, ",") {
+		if f, exists := mountFlags[option]; exists {
+			if f.clear {
+				flags &^= f.flag
+			} else {
+				flags |= f.flag
+			}
+		} else if option != "" {
+			data = append(data, option)
+		}
+	}
+	return flags, strings.Join(data, ",")
+}
+
+func bindMount(source, target string, readonly bool) error {
+	if err := mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("Unable to bind mount %s on %s: %s", source, target, err)
+	}
+	if readonly {
+		if err := mount(source, target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("Unable to remount %s read-only: %s", target, err)
+		}
+	}
+	return nil
+}
+
+func pivotRoot(rootfs string) error {
+	pivotDir, err := ioutil.TempDir(rootfs, ".pivot_root")
+	if err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(rootfs, pivotDir); err != nil {
+		return fmt.Errorf("pivot_root failed: %s", err)
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return err
+	}
+	// The old root is now mounted below the new one
+	pivotDir = path.Join("/", path.Base(pivotDir))
+	if err := syscall.Unmount(pivotDir, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("Unable to unmount the old root: %s", err)
+	}
+	return os.Remove(pivotDir)
+}
@@ -0,0 +1,19 @@
+package docker
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	flags, data := parseMountOptions(tmpfsOptions("size=64m,exec,mode=755"))
+	if flags != syscall.MS_NOSUID|syscall.MS_NODEV {
+		t.Errorf("Unexpected mount flags: %x", flags)
+	}
+	if data != "size=64m,mode=755" {
+		t.Errorf("Unexpected mount data: %s", data)
+	}
+	if flags, data := parseMountOptions("ro,rw,,ro"); flags != syscall.MS_RDONLY || data != "" {
+		t.Errorf("Unexpected mount flags and data: %x, %s", flags, data)
+	}
+}
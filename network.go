@@ -390,6 +390,7 @@ type IPAllocator struct {
 	network       *net.IPNet
 	queueAlloc    chan allocatedIP
 	queueReleased chan net.IP
+	queueReserved chan reservedIP
 	inUse         map[int32]struct{}
 }
 
@@ -398,6 +399,11 @@ type allocatedIP struct {
 	err error
 }
 
+type reservedIP struct {
+	ip  net.IP
+	err chan error
+}
+
 func (alloc *IPAllocator) run() {
 	firstIP, _ := networkRange(alloc.network)
 	ipNum := ipToInt(firstIP)
@@ -454,6 +460,20 @@ func (alloc *IPAllocator) run() {
 					pos--
 				}
 			}
+		case reserved := <-alloc.queueReserved:
+			r := ipToInt(reserved.ip)
+			if _, exists := alloc.inUse[r]; exists {
+				reserved.err <- fmt.Errorf("IP %s is already in use", reserved.ip)
+			} else if !alloc.network.Contains(reserved.ip) || r == ownIP {
+				reserved.err <- fmt.Errorf("IP %s is not available on %s", reserved.ip, alloc.network)
+			} else {
+				alloc.inUse[r] = struct{}{}
+				reserved.err <- nil
+			}
+			// Offer the IP found for this round again, unless it was reserved
+			if !inUse && r != newNum {
+				pos = newNum - ipNum
+			}
 		}
 	}
 }
@@ -467,11 +487,19 @@ func (alloc *IPAllocator) Release(ip net.IP) {
 	alloc.queueReleased <- ip
 }
 
+// Reserve marks ip as in use, if it isn't already.
+func (alloc *IPAllocator) Reserve(ip net.IP) error {
+	err := make(chan error)
+	alloc.queueReserved <- reservedIP{ip: ip, err: err}
+	return <-err
+}
+
 func newIPAllocator(network *net.IPNet) *IPAllocator {
 	alloc := &IPAllocator{
 		network:       network,
 		queueAlloc:    make(chan allocatedIP),
 		queueReleased: make(chan net.IP),
+		queueReserved: make(chan reservedIP),
 		inUse:         make(map[int32]struct{}),
 	}
 
@@ -662,6 +690,28 @@ func (manager *NetworkManager) Allocate() (*NetworkInterface, error) {
 	return iface, nil
 }
 
+// Restore returns the network interface of a container allocated before the
+// manager was created, reserving its address ip.
+func (manager *NetworkManager) Restore(ip net.IP) (*NetworkInterface, error) {
+
+	if manager.disabled {
+		return &NetworkInterface{disabled: true}, nil
+	}
+
+	if ip == nil {
+		return nil, fmt.Errorf("No IP to restore")
+	}
+	if err := manager.ipAllocator.Reserve(ip); err != nil {
+		return nil, err
+	}
+	iface := &NetworkInterface{
+		IPNet:   net.IPNet{IP: ip, Mask: manager.bridgeNetwork.Mask},
+		Gateway: manager.bridgeNetwork.IP,
+		manager: manager,
+	}
+	return iface, nil
+}
+
 func newNetworkManager(bridgeIface string) (*NetworkManager, error) {
 
 	if bridgeIface == DisableNetworkBridge {
@@ -7,6 +7,9 @@ import (
 )
 
 func TestIptables(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake mode doesn't use iptables")
+	}
 	if err := iptables("-L"); err != nil {
 		t.Fatal(err)
 	}
@@ -343,6 +346,32 @@ func TestIPAllocator(t *testing.T) {
 	}
 }
 
+func TestIPAllocatorReserve(t *testing.T) {
+	gwIP, n, _ := net.ParseCIDR("127.0.0.1/29")
+	alloc := newIPAllocator(&net.IPNet{IP: gwIP, Mask: n.Mask})
+
+	if err := alloc.Reserve(net.IPv4(127, 0, 0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []net.IP{net.IPv4(127, 0, 0, 3), net.IPv4(127, 0, 0, 1), net.IPv4(10, 0, 0, 3)} {
+		if err := alloc.Reserve(ip); err == nil {
+			t.Fatalf("Reserving %s should have failed", ip)
+		}
+	}
+
+	// The reserved IP is skipped
+	for _, expected := range []net.IP{net.IPv4(127, 0, 0, 2), net.IPv4(127, 0, 0, 4), net.IPv4(127, 0, 0, 5), net.IPv4(127, 0, 0, 6)} {
+		ip, err := alloc.Acquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIPEquals(t, expected, ip)
+	}
+	if _, err := alloc.Acquire(); err == nil {
+		t.Fatal("There shouldn't be any IP addresses at this point")
+	}
+}
+
 func assertIPEquals(t *testing.T, ip1, ip2 net.IP) {
 	if !ip1.Equal(ip2) {
 		t.Fatalf("Expected IP %s, got %s", ip1, ip2)
@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"unsafe"
+)
+
+// notifyOOM returns a channel receiving a value each time the memory control
+// group dir runs out of memory, which makes the kernel kill one of its
+// processes. It is closed once the group is removed.
+func notifyOOM(dir string) (<-chan struct{}, error) {
+	oomControl, err := os.Open(path.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		oomControl.Close()
+		return nil, errno
+	}
+	eventfd := os.NewFile(fd, "eventfd")
+	control := fmt.Sprintf("%d %d", eventfd.Fd(), oomControl.Fd())
+	if err := ioutil.WriteFile(path.Join(dir, "cgroup.event_control"), []byte(control), 0700); err != nil {
+		eventfd.Close()
+		oomControl.Close()
+		return nil, err
+	}
+
+	c := make(chan struct{})
+	go func() {
+		defer close(c)
+		defer oomControl.Close()
+		defer eventfd.Close()
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventfd.Read(buf); err != nil {
+				return
+			}
+			// The counter adds up the events since the last read
+			count := *(*uint64)(unsafe.Pointer(&buf[0]))
+			// The removal of the group is notified too, maybe along with
+			// the OOM kill of its last process
+			if _, err := os.Lstat(path.Join(dir, "cgroup.event_control")); os.IsNotExist(err) {
+				if count > 1 {
+					c <- struct{}{}
+				}
+				return
+			}
+			c <- struct{}{}
+		}
+	}()
+	return c, nil
+}
@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+func init() {
+	registerGraphDriver("overlay", func() (GraphDriver, error) {
+		if err := loadOverlay(); err != nil {
+			return nil, err
+		}
+		return &overlayDriver{}, nil
+	})
+}
+
+// overlayDriver mounts the layers with overlayfs, as found in mainline
+// kernels since 3.18. Multiple read-only layers require 4.0.
+// Layers are stored in the overlayfs format: removed files are character
+// devices 0/0, and directories hiding the layers below them have the
+// trusted.overlay.opaque attribute set.
+type overlayDriver struct {
+}
+
+func loadOverlay() error {
+	if supportsOverlay() {
+		return nil
+	}
+	log.Printf("Kernel does not support overlayfs, trying to load the overlay module with modprobe...")
+	if err := exec.Command("modprobe", "overlay").Run(); err != nil || !supportsOverlay() {
+		return fmt.Errorf("Unable to load the overlay module")
+	}
+	log.Printf("...module loaded.")
+	return nil
+}
+
+func supportsOverlay() bool {
+	data, err := ioutil.ReadFile("/proc/filesystems")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(strings.TrimPrefix(line, "nodev")) == "overlay" {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *overlayDriver) Name() string {
+	return "overlay"
+}
+
+func (d *overlayDriver) Create(layer string, data Archive) error {
+	if err := untarLayer(layer, data); err != nil {
+		return err
+	}
+	return aufsToOverlay(layer)
+}
+
+func (d *overlayDriver) Mount(layers []string, rw, target string) error {
+	work := overlayWorkPath(rw)
+	if err := os.MkdirAll(work, 0700); err != nil {
+		return err
+	}
+	// The options must fit in a page, which limits the number of layers
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(layers, ":"), rw, work)
+	if err := mount("overlay", target, "overlay", 0, options); err != nil {
+		return fmt.Errorf("Unable to mount using overlay: %s", err)
+	}
+	return nil
+}
+
+func (d *overlayDriver) Unmount(layers []string, rw, target string) error {
+	return Unmount(target)
+}
+
+func (d *overlayDriver) Mounted(target string) (bool, error) {
+	return Mounted(target)
+}
+
+func (d *overlayDriver) Diff(layers []string, rw, target string) (Archive, error) {
+	tmp, err := ioutil.TempDir(filepath.Dir(rw), "diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := overlayToAufs(rw, tmp); err != nil {
+		return nil, err
+	}
+	archive, err := Tar(tmp, Uncompressed)
+	if err != nil {
+		return nil, err
+	}
+	// Buffer the archive, so that tmp can be removed right away
+	return NewTempArchive(archive, filepath.Dir(rw))
+}
+
+func (d *overlayDriver) Changes(layers []string, rw, target string) ([]Change, error) {
+	return changes(layers, rw, func(path string, f os.FileInfo) (string, bool) {
+		return path, isOverlayWhiteout(f)
+	})
+}
+
+func (d *overlayDriver) Size(layers []string, rw, target string) (int64, error) {
+	return dirSize(rw)
+}
+
+// overlayWorkPath returns the scratch directory overlayfs needs next to the
+// read-write layer rw, on the same filesystem.
+func overlayWorkPath(rw string) string {
+	return rw + "-work"
+}
+
+func isOverlayWhiteout(f os.FileInfo) bool {
+	return f.Mode()&os.ModeCharDevice != 0 && f.Sys().(*syscall.Stat_t).Rdev == 0
+}
+
+func isOverlayOpaque(dir string) bool {
+	value := make([]byte, 1)
+	n, err := syscall.Getxattr(dir, "trusted.overlay.opaque", value)
+	return err == nil && n == 1 && value[0] == 'y'
+}
+
+// aufsToOverlay converts the whiteouts of layer from the AUFS format to the
+// overlayfs one, in place.
+func aufsToOverlay(layer string) error {
+	var whiteouts []string
+	err := filepath.Walk(layer, func(pth string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if isWhiteout(f.Name()) {
+			whiteouts = append(whiteouts, pth)
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, pth := range whiteouts {
+		dir, name := filepath.Split(pth)
+		parent, err := os.Lstat(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(pth); err != nil {
+			return err
+		}
+		switch {
+		case name == ".wh..wh..opq":
+			if err := syscall.Setxattr(dir, "trusted.overlay.opaque", []byte("y"), 0); err != nil {
+				return fmt.Errorf("Unable to mark %s as opaque: %s", dir, err)
+			}
+		case isWhiteoutMeta(name):
+			// Other AUFS metadata is of no use to overlayfs
+		default:
+			if err := syscall.Mknod(filepath.Join(dir, name[len(".wh."):]), syscall.S_IFCHR, 0); err != nil {
+				return fmt.Errorf("Unable to create the whiteout of %s: %s", pth, err)
+			}
+		}
+		// Keep the mtime of the directory as it was in the archive
+		if err := os.Chtimes(dir, parent.ModTime(), parent.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overlayToAufs copies the layer src, in the overlayfs format, into the
+// empty directory dst, in the AUFS format.
+func overlayToAufs(src, dst string) error {
+	inodes := make(map[uint64]string)
+	var dirs []string
+
+	err := filepath.Walk(src, func(pth string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, pth)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if isOverlayWhiteout(f) {
+			whiteout := filepath.Join(filepath.Dir(target), ".wh."+f.Name())
+			return ioutil.WriteFile(whiteout, []byte{}, 0600)
+		}
+		if f.IsDir() {
+			dirs = append(dirs, rel)
+			if err := copyEntry(pth, target, f); err != nil {
+				return err
+			}
+			if isOverlayOpaque(pth) {
+				return ioutil.WriteFile(filepath.Join(target, ".wh..wh..opq"), []byte{}, 0600)
+			}
+			return nil
+		}
+		stat := f.Sys().(*syscall.Stat_t)
+		if stat.Nlink > 1 {
+			if first, exists := inodes[uint64(stat.Ino)]; exists {
+				return os.Link(first, target)
+			}
+			inodes[uint64(stat.Ino)] = target
+		}
+		return copyEntry(pth, target, f)
+	})
+	if err != nil {
+		return err
+	}
+	// Creating entries changes the mtime of their parents: restore them last
+	for i := len(dirs) - 1; i >= 0; i-- {
+		f, err := os.Lstat(filepath.Join(src, dirs[i]))
+		if err != nil {
+			return err
+		}
+		if err := os.Chtimes(filepath.Join(dst, dirs[i]), f.ModTime(), f.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestOverlayDriver(t *testing.T) {
+	if unitTestFake || !supportsOverlay() {
+		t.Skip("overlayfs is not available")
+	}
+	tmp, err := ioutil.TempDir("", "docker-test-overlay-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Layers come in the AUFS format
+	src := path.Join(tmp, "src")
+	writeFile(path.Join(src, "base/etc/passwd"), "root", t)
+	writeFile(path.Join(src, "base/etc/hosts"), "localhost", t)
+	writeFile(path.Join(src, "base/bin/sh"), "sh", t)
+	writeFile(path.Join(src, "top/etc/motd"), "hello", t)
+	writeFile(path.Join(src, "top/.wh.bin"), "", t)
+
+	driver := &overlayDriver{}
+	base := path.Join(tmp, "base")
+	top := path.Join(tmp, "top")
+	for _, layer := range []string{base, top} {
+		archive, err := Tar(path.Join(src, path.Base(layer)), Uncompressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := driver.Create(layer, archive); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f, err := os.Lstat(path.Join(top, "bin")); err != nil || !isOverlayWhiteout(f) {
+		t.Fatalf("The whiteout of /bin should have been converted (%v)", err)
+	}
+
+	layers := []string{top, base}
+	rw := path.Join(tmp, "rw")
+	rootfs := path.Join(tmp, "rootfs")
+	if err := driver.Create(rw, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(rootfs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Mount(layers, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Unmount(layers, rw, rootfs)
+	if _, err := os.Stat(path.Join(rootfs, "bin")); !os.IsNotExist(err) {
+		t.Fatalf("/bin should have been removed by the whiteout of the top layer")
+	}
+
+	// Make some changes
+	if err := os.Remove(path.Join(rootfs, "etc/passwd")); err != nil {
+		t.Fatal(err)
+	}
+	// Files left open would keep the mount busy: don't use writeFile
+	if err := ioutil.WriteFile(path.Join(rootfs, "etc/hosts"), []byte("127.0.0.1 localhost"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path.Join(rootfs, "tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(rootfs, "tmp/foo"), []byte("bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"A /tmp", "A /tmp/foo", "C /etc", "C /etc/hosts", "D /etc/passwd"}
+	checkDriverChanges(driver, layers, rw, rootfs, expected, t)
+
+	if err := driver.Unmount(layers, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+
+	// The diff is in the AUFS format again
+	diff, err := driver.Diff(layers, rw, rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := path.Join(tmp, "diff")
+	if err := os.Mkdir(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Untar(diff, dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(dst, "etc/.wh.passwd")); err != nil {
+		t.Fatalf("The diff should contain the whiteout of /etc/passwd (%v)", err)
+	}
+	if content := readFile(path.Join(dst, "tmp/foo"), t); content != "bar" {
+		t.Fatalf("Expected /tmp/foo to contain bar, found %s", content)
+	}
+}
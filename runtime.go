@@ -8,15 +8,20 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 )
 
 type Capabilities struct {
 	MemoryLimit            bool
 	SwapLimit              bool
+	CpusetLimit            bool
+	BlkioWeight            bool
+	BlkioThrottle          bool
+	PidsLimit              bool
 	IPv4ForwardingDisabled bool
 }
 
@@ -25,9 +30,14 @@ type Runtime struct {
 	repository     string
 	containers     *list.List
 	networkManager *NetworkManager
+	execDriver     ExecDriver
 	graph          *Graph
 	repositories   *TagStore
 	idIndex        *utils.TruncIndex
+	names          map[string]string // Ids of the containers by name, guarded by namesLock
+	namesLock      sync.Mutex
+	execs          map[string]*Exec // Guarded by execsLock
+	execsLock      sync.Mutex
 	capabilities   *Capabilities
 	kernelVersion  *utils.KernelVersionInfo
 	autoRestart    bool
@@ -60,7 +70,14 @@ func (runtime *Runtime) getContainerElement(id string) *list.Element {
 	return nil
 }
 
+// Get returns the container with the given name, or which id starts with
+// name, or nil if there is none.
 func (runtime *Runtime) Get(name string) *Container {
+	runtime.namesLock.Lock()
+	if id, exists := runtime.names[name]; exists {
+		name = id
+	}
+	runtime.namesLock.Unlock()
 	id, err := runtime.idIndex.Get(name)
 	if err != nil {
 		return nil
@@ -105,6 +122,11 @@ func (runtime *Runtime) Register(container *Container) error {
 	if err := validateID(container.ID); err != nil {
 		return err
 	}
+	if container.Name != "" {
+		if err := runtime.reserveName(container.Name, container.ID); err != nil {
+			return err
+		}
+	}
 
 	// init the wait lock
 	container.waitLock = make(chan struct{})
@@ -124,35 +146,28 @@ func (runtime *Runtime) Register(container *Container) error {
 	runtime.containers.PushBack(container)
 	runtime.idIndex.Add(container.ID)
 
-	// When we actually restart, Start() do the monitoring.
-	// However, when we simply 'reattach', we have to restart a monitor
-	nomonitor := false
-
-	// FIXME: if the container is supposed to be running but is not, auto restart it?
-	//        if so, then we need to restart monitor and init a new lock
 	// If the container is supposed to be running, make sure of it
 	if container.State.Running {
-		output, err := exec.Command("lxc-info", "-n", container.ID).CombinedOutput()
+		info, err := runtime.execDriver.Info(container)
 		if err != nil {
 			return err
 		}
-		if !strings.Contains(string(output), "RUNNING") {
+		if !info.Running {
 			utils.Debugf("Container %s was supposed to be running be is not.", container.ID)
-			if runtime.autoRestart {
-				utils.Debugf("Restarting")
-				container.State.Ghost = false
-				container.State.setStopped(0)
-				hostConfig := &HostConfig{}
-				if err := container.Start(hostConfig); err != nil {
-					return err
-				}
-				nomonitor = true
-			} else {
-				utils.Debugf("Marking as stopped")
-				container.State.setStopped(-127)
-				if err := container.ToDisk(); err != nil {
-					return err
-				}
+			container.State.Lock()
+			container.State.Ghost = false
+			exitCode := -127
+			if status, err := container.readExitStatus(); err == nil {
+				exitCode = status
+			}
+			container.State.setStopped(exitCode)
+			// Started again by restartContainers, once the targets of its
+			// links are registered too
+			container.State.Restarting = runtime.autoRestart || container.shouldRestart()
+			err := container.ToDisk()
+			container.State.Unlock()
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -161,13 +176,73 @@ func (runtime *Runtime) Register(container *Container) error {
 	// then close the wait lock chan (will be reset upon start)
 	if !container.State.Running {
 		close(container.waitLock)
-	} else if !nomonitor {
-		container.allocateNetwork()
+	} else {
+		if err := container.restore(); err != nil {
+			log.Printf("%s: Unable to restore the container: %s", container.ID, err)
+			container.State.Ghost = true
+		} else {
+			container.startHealthcheck()
+			container.watchOOM()
+		}
 		go container.monitor()
 	}
 	return nil
 }
 
+var validContainerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// checkName returns an error if name can't be given to a new container.
+// The name is only reserved by reserveName.
+func (runtime *Runtime) checkName(name string) error {
+	runtime.namesLock.Lock()
+	defer runtime.namesLock.Unlock()
+	return runtime.checkNameLocked(name)
+}
+
+// checkNameLocked is checkName, for callers holding namesLock.
+func (runtime *Runtime) checkNameLocked(name string) error {
+	if !validContainerName.MatchString(name) {
+		return fmt.Errorf("Invalid container name (%s), only [a-zA-Z0-9][a-zA-Z0-9_.-] are allowed", name)
+	}
+	if id, exists := runtime.names[name]; exists {
+		return fmt.Errorf("Conflict, the name %s is already assigned to %s", name, utils.TruncateID(id))
+	}
+	return nil
+}
+
+// reserveName gives name to the container id, unless it is taken. The check
+// and the assignment are atomic, so that two containers can't get the same
+// name.
+func (runtime *Runtime) reserveName(name, id string) error {
+	runtime.namesLock.Lock()
+	defer runtime.namesLock.Unlock()
+	if err := runtime.checkNameLocked(name); err != nil {
+		return err
+	}
+	runtime.names[name] = id
+	return nil
+}
+
+// Rename gives the name newName to container, in place of its current one.
+func (runtime *Runtime) Rename(container *Container, newName string) error {
+	runtime.namesLock.Lock()
+	defer runtime.namesLock.Unlock()
+	if err := runtime.checkNameLocked(newName); err != nil {
+		return err
+	}
+	oldName := container.Name
+	container.Name = newName
+	if err := container.ToDisk(); err != nil {
+		container.Name = oldName
+		return err
+	}
+	if oldName != "" {
+		delete(runtime.names, oldName)
+	}
+	runtime.names[newName] = container.ID
+	return nil
+}
+
 func (runtime *Runtime) LogToDisk(src *utils.WriteBroadcaster, dst, stream string) error {
 	log, err := os.OpenFile(dst, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
 	if err != nil {
@@ -199,6 +274,18 @@ func (runtime *Runtime) Destroy(container *Container) error {
 	}
 	// Deregister the container before removing its directory, to avoid race conditions
 	runtime.idIndex.Delete(container.ID)
+	if container.Name != "" {
+		runtime.namesLock.Lock()
+		delete(runtime.names, container.Name)
+		runtime.namesLock.Unlock()
+	}
+	runtime.execsLock.Lock()
+	for id, e := range runtime.execs {
+		if e.container == container {
+			delete(runtime.execs, id)
+		}
+	}
+	runtime.execsLock.Unlock()
 	runtime.containers.Remove(element)
 	if err := os.RemoveAll(container.root); err != nil {
 		return fmt.Errorf("Unable to remove filesystem for %v: %v", container.ID, err)
@@ -230,9 +317,30 @@ func (runtime *Runtime) restore() error {
 	if os.Getenv("DEBUG") == "" {
 		fmt.Printf("\bdone.\n")
 	}
+	var restarting []*Container
+	for _, container := range runtime.List() {
+		container.State.Lock()
+		if container.State.Restarting {
+			restarting = append(restarting, container)
+		}
+		container.State.Unlock()
+	}
+	go restartContainers(runtime.linkOrder(restarting))
 	return nil
 }
 
+// restartContainers starts the containers the restart policy of which
+// applies to their exit while the daemon was down, one after the other in
+// this order.
+func restartContainers(containers []*Container) {
+	for _, container := range containers {
+		container.State.Lock()
+		delay := container.nextRestartDelay()
+		container.State.Unlock()
+		container.restartAfterBackoff(delay)
+	}
+}
+
 func (runtime *Runtime) UpdateCapabilities(quiet bool) {
 	if cgroupMemoryMountpoint, err := utils.FindCgroupMountpoint("memory"); err != nil {
 		if !quiet {
@@ -253,6 +361,32 @@ func (runtime *Runtime) UpdateCapabilities(quiet bool) {
 		}
 	}
 
+	if mountpoint, err := utils.FindCgroupMountpoint("cpuset"); err == nil {
+		_, err := os.Stat(path.Join(mountpoint, "cpuset.cpus"))
+		runtime.capabilities.CpusetLimit = err == nil
+	}
+	if !runtime.capabilities.CpusetLimit && !quiet {
+		log.Printf("WARNING: Your kernel does not support cgroup cpuset.")
+	}
+	if mountpoint, err := utils.FindCgroupMountpoint("blkio"); err == nil {
+		_, err1 := os.Stat(path.Join(mountpoint, "blkio.weight"))
+		runtime.capabilities.BlkioWeight = err1 == nil
+		_, err2 := os.Stat(path.Join(mountpoint, "blkio.throttle.read_bps_device"))
+		runtime.capabilities.BlkioThrottle = err2 == nil
+	}
+	if !runtime.capabilities.BlkioWeight && !quiet {
+		log.Printf("WARNING: Your kernel does not support cgroup blkio weight.")
+	}
+	if !runtime.capabilities.BlkioThrottle && !quiet {
+		log.Printf("WARNING: Your kernel does not support cgroup blkio throttling.")
+	}
+	// Only the groups below the root one have a pids.max
+	_, err := utils.FindCgroupMountpoint("pids")
+	runtime.capabilities.PidsLimit = err == nil
+	if !runtime.capabilities.PidsLimit && !quiet {
+		log.Printf("WARNING: Your kernel does not support cgroup pids limit.")
+	}
+
 	content, err3 := ioutil.ReadFile("/proc/sys/net/ipv4/ip_forward")
 	runtime.capabilities.IPv4ForwardingDisabled = err3 != nil || len(content) == 0 || content[0] != '1'
 	if runtime.capabilities.IPv4ForwardingDisabled && !quiet {
@@ -280,6 +414,40 @@ func NewRuntime(flGraphPath string, autoRestart bool, dns []string) (*Runtime, e
 	return runtime, nil
 }
 
+// loadGraphDriver returns the storage driver of the runtime at root. Layers
+// are kept in the format of the driver which created them, so the driver is
+// recorded along with them and can't be changed afterwards. An empty name
+// selects the recorded driver.
+func loadGraphDriver(root, name string) (GraphDriver, error) {
+	recordPath := path.Join(root, "graphdriver")
+	var recorded string
+	if data, err := ioutil.ReadFile(recordPath); err == nil {
+		recorded = strings.TrimSpace(string(data))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else if images, err := ioutil.ReadDir(path.Join(root, "graph")); err == nil && len(images) > 0 {
+		// Graphs which predate the record were all created with AUFS
+		recorded = "aufs"
+	}
+	if name == "" {
+		name = recorded
+	}
+	if name == "" {
+		name = DefaultGraphDriver
+	}
+	if recorded != "" && name != recorded {
+		return nil, fmt.Errorf("The graph at %s was created with the %s storage driver and can't be used with %s", root, recorded, name)
+	}
+	driver, err := newGraphDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(recordPath, []byte(name), 0600); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
 func NewRuntimeFromDirectory(root string, autoRestart bool) (*Runtime, error) {
 	runtimeRepo := path.Join(root, "containers")
 
@@ -287,11 +455,15 @@ func NewRuntimeFromDirectory(root string, autoRestart bool) (*Runtime, error) {
 		return nil, err
 	}
 
-	g, err := NewGraph(path.Join(root, "graph"))
+	graphDriver, err := loadGraphDriver(root, GraphDriverName)
 	if err != nil {
 		return nil, err
 	}
-	volumes, err := NewGraph(path.Join(root, "volumes"))
+	g, err := NewGraph(path.Join(root, "graph"), graphDriver)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := NewGraph(path.Join(root, "volumes"), graphDriver)
 	if err != nil {
 		return nil, err
 	}
@@ -306,14 +478,24 @@ func NewRuntimeFromDirectory(root string, autoRestart bool) (*Runtime, error) {
 	if err != nil {
 		return nil, err
 	}
+	if ExecDriverName == "" {
+		ExecDriverName = DefaultExecDriver
+	}
+	execDriver, err := newExecDriver(ExecDriverName, root)
+	if err != nil {
+		return nil, err
+	}
 	runtime := &Runtime{
 		root:           root,
 		repository:     runtimeRepo,
 		containers:     list.New(),
 		networkManager: netManager,
+		execDriver:     execDriver,
 		graph:          g,
 		repositories:   repositories,
 		idIndex:        utils.NewTruncIndex(),
+		names:          make(map[string]string),
+		execs:          make(map[string]*Exec),
 		capabilities:   &Capabilities{},
 		autoRestart:    autoRestart,
 		volumes:        volumes,
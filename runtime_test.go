@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"github.com/dotcloud/docker/utils"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"path"
 	"runtime"
 	"strconv"
 	"strings"
@@ -21,12 +23,20 @@ const (
 	unitTestImageName     = "docker-test-image"
 	unitTestImageID       = "83599e29c455eb719f77d799bc7c51521b9551972f5a850d7ad265bc1b5292f6" // 1.0
 	unitTestNetworkBridge = "testdockbr0"
-	unitTestStoreBase     = "/var/lib/docker/unit-tests"
 	testDaemonAddr        = "127.0.0.1:4270"
 	testDaemonProto       = "tcp"
 )
 
 var (
+	unitTestStoreBase = "/var/lib/docker/unit-tests"
+
+	// When set, the tests use the fake execution driver and the copy layer
+	// store, without networking nor a pulled test image, and run as any user.
+	// The commands of the containers then run on the host: do not run the
+	// tests as root in this mode. The tests that need a real container skip
+	// themselves.
+	unitTestFake = os.Getenv("DOCKER_TEST_FAKE") != ""
+
 	globalRuntime   *Runtime
 	startFds        int
 	startGoroutines int
@@ -73,17 +83,23 @@ func layerArchive(tarfile string) (io.Reader, error) {
 
 func init() {
 	// Hack to run sys init during unit testing
-	if selfPath := utils.SelfPath(); selfPath == "/sbin/init" || selfPath == "/.dockerinit" {
+	if IsSysInit() {
 		SysInit()
 		return
 	}
 
-	if uid := syscall.Geteuid(); uid != 0 {
-		log.Fatal("docker tests need to be run as root")
+	if unitTestFake {
+		ExecDriverName = "fake"
+		GraphDriverName = "vfs"
+		NetworkBridgeIface = DisableNetworkBridge
+		unitTestStoreBase = path.Join(os.TempDir(), "docker-unit-tests")
+	} else {
+		if uid := syscall.Geteuid(); uid != 0 {
+			log.Fatal("docker tests need to be run as root")
+		}
+		NetworkBridgeIface = unitTestNetworkBridge
 	}
 
-	NetworkBridgeIface = unitTestNetworkBridge
-
 	// Make it our Store root
 	if runtime, err := NewRuntimeFromDirectory(unitTestStoreBase, false); err != nil {
 		panic(err)
@@ -98,6 +114,11 @@ func init() {
 		pullingPool: make(map[string]struct{}),
 		pushingPool: make(map[string]struct{}),
 	}
+	if unitTestFake {
+		if err := registerFakeTestImage(globalRuntime); err != nil {
+			panic(err)
+		}
+	}
 	// If the unit test is not found, try to download it.
 	if img, err := globalRuntime.repositories.LookupImage(unitTestImageName); err != nil || img.ID != unitTestImageID {
 		// Retrieve the Image
@@ -118,6 +139,24 @@ func init() {
 	startFds, startGoroutines = utils.GetTotalUsedFds(), runtime.NumGoroutine()
 }
 
+// registerFakeTestImage registers an empty image in place of the test image,
+// so that no network access is needed.
+func registerFakeTestImage(runtime *Runtime) error {
+	if runtime.graph.Exists(unitTestImageID) {
+		return nil
+	}
+	img := &Image{
+		ID:            unitTestImageID,
+		Created:       time.Now(),
+		DockerVersion: VERSION,
+		Architecture:  "x86_64",
+	}
+	if err := runtime.graph.Register(nil, nil, img); err != nil {
+		return err
+	}
+	return runtime.repositories.Set(unitTestImageName, DEFAULTTAG, unitTestImageID, true)
+}
+
 // FIXME: test that ImagePull(json=true) send correct json output
 
 func GetTestImage(runtime *Runtime) *Image {
@@ -147,7 +186,7 @@ func TestRuntimeCreate(t *testing.T) {
 	container, err := builder.Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"ls", "-al"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -188,7 +227,7 @@ func TestRuntimeCreate(t *testing.T) {
 	_, err = builder.Create(
 		&Config{
 			Image: GetTestImage(runtime).ID,
-		},
+		}, "",
 	)
 	if err == nil {
 		t.Fatal("Builder.Create should throw an error when Cmd is missing")
@@ -198,7 +237,7 @@ func TestRuntimeCreate(t *testing.T) {
 		&Config{
 			Image: GetTestImage(runtime).ID,
 			Cmd:   []string{},
-		},
+		}, "",
 	)
 	if err == nil {
 		t.Fatal("Builder.Create should throw an error when Cmd is empty")
@@ -211,7 +250,7 @@ func TestDestroy(t *testing.T) {
 	container, err := NewBuilder(runtime).Create(&Config{
 		Image: GetTestImage(runtime).ID,
 		Cmd:   []string{"ls", "-al"},
-	},
+	}, "",
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -276,6 +315,98 @@ func TestGet(t *testing.T) {
 
 }
 
+func TestContainerNames(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+
+	builder := NewBuilder(runtime)
+	config := &Config{Image: GetTestImage(runtime).ID, Cmd: []string{"ls", "-al"}}
+
+	container1, err := builder.Create(config, "webapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container1)
+
+	if runtime.Get("webapp") != container1 {
+		t.Errorf("Get(webapp) returned %v while expecting %v", runtime.Get("webapp"), container1)
+	}
+	if _, err := builder.Create(config, "webapp"); err == nil {
+		t.Fatalf("Creating a container with a name already in use should fail")
+	}
+	if _, err := builder.Create(config, "-webapp"); err == nil {
+		t.Fatalf("Creating a container with an invalid name should fail")
+	}
+
+	container2, err := builder.Create(config, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.Rename(container2, "webapp"); err == nil {
+		t.Fatalf("Renaming a container to a name already in use should fail")
+	}
+	if err := runtime.Rename(container2, "database"); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.Get("db") != nil {
+		t.Errorf("The old name of a renamed container should be released")
+	}
+	if runtime.Get("database") != container2 {
+		t.Errorf("Get(database) returned %v while expecting %v", runtime.Get("database"), container2)
+	}
+
+	// Destroying a container releases its name
+	if err := runtime.Destroy(container2); err != nil {
+		t.Fatal(err)
+	}
+	container3, err := builder.Create(config, "database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.Destroy(container3)
+
+	// Names are restored with the containers
+	runtime2, err := NewRuntimeFromDirectory(runtime.root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := runtime2.Get("webapp"); c == nil || c.ID != container1.ID {
+		t.Errorf("Get(webapp) returned %v after restore while expecting %s", c, container1.ID)
+	}
+}
+
+// Only one of the containers created at the same time with the same name
+// gets it
+func TestContainerNamesConcurrent(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+
+	builder := NewBuilder(runtime)
+	config := &Config{Image: GetTestImage(runtime).ID, Cmd: []string{"ls", "-al"}}
+
+	created := make(chan *Container, 10)
+	for i := 0; i < cap(created); i++ {
+		go func() {
+			container, _ := builder.Create(config, "webapp")
+			created <- container
+		}()
+	}
+	var winners int
+	for i := 0; i < cap(created); i++ {
+		if container := <-created; container != nil {
+			winners++
+			if runtime.Get("webapp") != container {
+				t.Errorf("Get(webapp) returned %v while expecting %v", runtime.Get("webapp"), container)
+			}
+		}
+	}
+	if winners != 1 {
+		t.Fatalf("Expected 1 container to get the name webapp, %d did", winners)
+	}
+	if len(runtime.List()) != 1 {
+		t.Fatalf("Expected 1 container, %d found", len(runtime.List()))
+	}
+}
 func startEchoServerContainer(t *testing.T, proto string) (*Runtime, *Container, string) {
 	var err error
 	runtime := mkRuntime(t)
@@ -298,7 +429,7 @@ func startEchoServerContainer(t *testing.T, proto string) (*Runtime, *Container,
 			Image:     GetTestImage(runtime).ID,
 			Cmd:       []string{"sh", "-c", cmd},
 			PortSpecs: []string{fmt.Sprintf("%s/%s", strPort, proto)},
-		})
+		}, "")
 		if container != nil {
 			break
 		}
@@ -330,6 +461,9 @@ func startEchoServerContainer(t *testing.T, proto string) (*Runtime, *Container,
 
 // Run a container with a TCP port allocated, and test that it can receive connections on localhost
 func TestAllocateTCPPortLocalhost(t *testing.T) {
+	if unitTestFake {
+		t.Skip("Port mappings need the network bridge")
+	}
 	runtime, container, port := startEchoServerContainer(t, "tcp")
 	defer nuke(runtime)
 	defer container.Kill()
@@ -379,6 +513,9 @@ func TestAllocateTCPPortLocalhost(t *testing.T) {
 
 // Run a container with an UDP port allocated, and test that it can receive connections on localhost
 func TestAllocateUDPPortLocalhost(t *testing.T) {
+	if unitTestFake {
+		t.Skip("Port mappings need the network bridge")
+	}
 	runtime, container, port := startEchoServerContainer(t, "udp")
 	defer nuke(runtime)
 	defer container.Kill()
@@ -483,3 +620,171 @@ func TestRestore(t *testing.T) {
 	}
 	container2.State.Running = false
 }
+
+// The restart policies apply to the containers which exited while the
+// daemon was down, once all of them are registered
+func TestRestartPolicyAfterCrash(t *testing.T) {
+	runtime1 := mkRuntime(t)
+	defer nuke(runtime1)
+	builder := NewBuilder(runtime1)
+	var containers []*Container
+	for _, name := range []string{"web", "db"} {
+		container, err := builder.Create(&Config{Image: GetTestImage(runtime1).ID, Cmd: []string{"sleep", "10"}}, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer runtime1.Destroy(container)
+		hostConfig := &HostConfig{RestartPolicy: RestartPolicy{Name: "always"}}
+		if name == "web" {
+			hostConfig.Links = []string{"db:db"}
+		}
+		if err := container.SaveHostConfig(hostConfig); err != nil {
+			t.Fatal(err)
+		}
+		// Simulate a crash of dockerd along with the processes of the
+		// containers
+		container.State.Running = true
+		if err := container.ToDisk(); err != nil {
+			t.Fatal(err)
+		}
+		container.State.Running = false
+		containers = append(containers, container)
+	}
+
+	runtime2, err := NewRuntimeFromDirectory(runtime1.root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nuke(runtime2)
+	web, db := runtime2.Get(containers[0].ID), runtime2.Get(containers[1].ID)
+	if order := runtime2.linkOrder([]*Container{web, db}); order[0] != db || order[1] != web {
+		t.Fatalf("The target of the link should be restarted first")
+	}
+	// Not running until the policy applies, which doesn't keep Wait from
+	// returning
+	setTimeout(t, "Waiting for the container timed out", 2*time.Second, func() {
+		web.Wait()
+	})
+	setTimeout(t, "The container was not restarted", 5*time.Second, func() {
+		for {
+			db.State.Lock()
+			running := db.State.Running
+			db.State.Unlock()
+			if running {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	db.Kill()
+	web.Kill()
+}
+
+func TestLiveRestore(t *testing.T) {
+	runtime1 := mkRuntime(t)
+	defer nuke(runtime1)
+	// stdin reaches EOF when dockerd is gone: keep on reading it
+	container1, _, _ := mkContainer(runtime1, []string{"-i", "-d", "_", "sh", "-c", "while true; do read line && echo $line || sleep 0.1; done"}, t)
+	defer runtime1.Destroy(container1)
+	if err := container1.Start(&HostConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash/manual quit of dockerd: the container keeps on running
+	for _, fifo := range container1.fifos {
+		fifo.Close()
+	}
+
+	runtime2, err := NewRuntimeFromDirectory(runtime1.root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nuke(runtime2)
+	container2 := runtime2.Get(container1.ID)
+	if container2 == nil {
+		t.Fatal("Unable to Get container")
+	}
+	if !container2.State.Running || container2.State.Ghost {
+		t.Fatalf("The container should have been adopted, found %s", container2.State.String())
+	}
+
+	// The streams of the container are attached again
+	stdin, err := container2.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := container2.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTimeout(t, "Read/Write assertion timed out", 2*time.Second, func() {
+		if err := assertPipe("hello\n", "hello", stdout, stdin, 15); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// The fake driver has no dockerinit to record the exit status of the
+	// program, which a new daemon can't wait for
+	if err := ioutil.WriteFile(container2.ExitStatusPath(), []byte("143\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := container2.Stop(3); err != nil {
+		t.Fatal(err)
+	}
+	if container2.State.Running {
+		t.Fatalf("The container should be stopped")
+	}
+	if container2.State.ExitCode != 143 {
+		t.Fatalf("The exit status recorded by dockerinit should have been read, found %d", container2.State.ExitCode)
+	}
+	logs, err := container2.ReadLog("json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(logs); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(data), "hello") {
+		t.Fatalf("The output of the adopted container should have been logged")
+	}
+}
+
+func TestUnknownExecDriver(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	defaultDriver := ExecDriverName
+	defer func() { ExecDriverName = defaultDriver }()
+
+	ExecDriverName = "unknown"
+	if _, err := NewRuntimeFromDirectory(root, false); err == nil {
+		t.Fatal("Expected an error when using an unknown execution driver")
+	}
+}
+
+func TestGraphDriverRecorded(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	driver, err := loadGraphDriver(root, "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if driver.Name() != "vfs" {
+		t.Fatalf("Expected the vfs driver, found %s", driver.Name())
+	}
+	// Without a name, the recorded driver is used
+	if driver, err = loadGraphDriver(root, ""); err != nil {
+		t.Fatal(err)
+	} else if driver.Name() != "vfs" {
+		t.Fatalf("Expected the recorded vfs driver, found %s", driver.Name())
+	}
+	if _, err := loadGraphDriver(root, "aufs"); err == nil {
+		t.Fatal("Expected an error when switching to another storage driver")
+	}
+}
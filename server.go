@@ -1,7 +1,6 @@
 package docker
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,6 +16,7 @@ import (
 	"os/exec"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -71,9 +71,17 @@ func (srv *Server) versionInfos() []utils.VersionInfo {
 	return ret
 }
 
-func (srv *Server) ContainerKill(name string) error {
+// ContainerKill sends sig to the container name. With SIGKILL, or 0, it
+// waits for the container to exit.
+func (srv *Server) ContainerKill(name string, sig int) error {
 	if container := srv.runtime.Get(name); container != nil {
-		if err := container.Kill(); err != nil {
+		var err error
+		if sig == 0 || sig == 9 {
+			err = container.Kill()
+		} else {
+			err = container.Signal(sig)
+		}
+		if err != nil {
 			return fmt.Errorf("Error killing container %s: %s", name, err)
 		}
 		srv.LogEvent("kill", container.ShortID(), srv.runtime.repositories.ImageName(container.Image))
@@ -140,7 +148,7 @@ func (srv *Server) ImageInsert(name, url, path string, out io.Writer, sf *utils.
 	}
 
 	b := NewBuilder(srv.runtime)
-	c, err := b.Create(config)
+	c, err := b.Create(config, "")
 	if err != nil {
 		return "", err
 	}
@@ -195,7 +203,7 @@ func (srv *Server) ImagesViz(out io.Writer) error {
 	return nil
 }
 
-func (srv *Server) Images(all bool, filter string) ([]APIImages, error) {
+func (srv *Server) Images(all bool, filter string, filters Filters) ([]APIImages, error) {
 	var (
 		allImages map[string]*Image
 		err       error
@@ -208,6 +216,10 @@ func (srv *Server) Images(all bool, filter string) ([]APIImages, error) {
 	if err != nil {
 		return nil, err
 	}
+	ancestors, err := srv.resolveAncestors(filters)
+	if err != nil {
+		return nil, err
+	}
 	outs := []APIImages{} //produce [] when empty instead of 'null'
 	for name, repository := range srv.runtime.repositories.Repositories {
 		if filter != "" && name != filter {
@@ -221,23 +233,31 @@ func (srv *Server) Images(all bool, filter string) ([]APIImages, error) {
 				continue
 			}
 			delete(allImages, id)
+			if !filters.matchImage(image, name, name+":"+tag) || !filters.matchAncestors(image, ancestors) {
+				continue
+			}
 			out.Repository = name
 			out.Tag = tag
 			out.ID = image.ID
 			out.Created = image.Created.Unix()
 			out.Size = image.Size
 			out.VirtualSize = image.getParentsSize(0) + image.Size
+			out.Labels = image.labels()
 			outs = append(outs, out)
 		}
 	}
 	// Display images which aren't part of a
 	if filter == "" {
 		for _, image := range allImages {
+			if !filters.matchImage(image) || !filters.matchAncestors(image, ancestors) {
+				continue
+			}
 			var out APIImages
 			out.ID = image.ID
 			out.Created = image.Created.Unix()
 			out.Size = image.Size
 			out.VirtualSize = image.getParentsSize(0) + image.Size
+			out.Labels = image.labels()
 			outs = append(outs, out)
 		}
 	}
@@ -255,10 +275,13 @@ func (srv *Server) DockerInfo() *APIInfo {
 		imgcount = len(images)
 	}
 	lxcVersion := ""
-	if output, err := exec.Command("lxc-version").CombinedOutput(); err == nil {
-		outputStr := string(output)
-		if len(strings.SplitN(outputStr, ":", 2)) == 2 {
-			lxcVersion = strings.TrimSpace(strings.SplitN(string(output), ":", 2)[1])
+	// Only the lxc driver depends on the lxc userland tools
+	if srv.runtime.execDriver.Name() == "lxc" {
+		if output, err := exec.Command("lxc-version").CombinedOutput(); err == nil {
+			outputStr := string(output)
+			if len(strings.SplitN(outputStr, ":", 2)) == 2 {
+				lxcVersion = strings.TrimSpace(strings.SplitN(string(output), ":", 2)[1])
+			}
 		}
 	}
 	kernelVersion := "<unknown>"
@@ -276,6 +299,8 @@ func (srv *Server) DockerInfo() *APIInfo {
 		NFd:                utils.GetTotalUsedFds(),
 		NGoroutines:        runtime.NumGoroutine(),
 		LXCVersion:         lxcVersion,
+		ExecutionDriver:    srv.runtime.execDriver.Name(),
+		StorageDriver:      srv.runtime.graph.driver.Name(),
 		NEventsListener:    len(srv.events),
 		KernelVersion:      kernelVersion,
 		IndexServerAddress: auth.IndexServerAddress(),
@@ -313,31 +338,67 @@ func (srv *Server) ImageHistory(name string) ([]APIHistory, error) {
 
 }
 
+func (srv *Server) ContainerStats(name string) (*APIStats, error) {
+	if container := srv.runtime.Get(name); container != nil {
+		return container.Stats()
+	}
+	return nil, fmt.Errorf("No such container: %s", name)
+}
+
 func (srv *Server) ContainerTop(name, ps_args string) (*APITop, error) {
 	if container := srv.runtime.Get(name); container != nil {
-		output, err := exec.Command("lxc-ps", "--name", container.ID, "--", ps_args).CombinedOutput()
+		if !container.State.Running {
+			return nil, fmt.Errorf("Container %s is not running", name)
+		}
+		pids, err := srv.runtime.execDriver.Pids(container)
 		if err != nil {
-			return nil, fmt.Errorf("Error trying to use lxc-ps: %s (%s)", err, output)
+			return nil, err
+		}
+		// Restrict ps to the processes of the container, and filter its
+		// output below in case ps_args selects other processes as well.
+		args := strings.Fields(ps_args)
+		if len(pids) > 0 {
+			var strPids []string
+			for _, pid := range pids {
+				strPids = append(strPids, strconv.Itoa(pid))
+			}
+			args = append(args, "-p", strings.Join(strPids, ","))
+		}
+		output, err := exec.Command("ps", args...).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("Error running ps: %s (%s)", err, output)
 		}
 		procs := APITop{}
-		for i, line := range strings.Split(string(output), "\n") {
+		lines := strings.Split(string(output), "\n")
+		procs.Titles = strings.Fields(lines[0])
+
+		pidIndex := -1
+		for i, title := range procs.Titles {
+			if title == "PID" {
+				pidIndex = i
+			}
+		}
+		if pidIndex == -1 {
+			return nil, fmt.Errorf("Couldn't find PID field in ps output")
+		}
+
+		for _, line := range lines[1:] {
 			if len(line) == 0 {
 				continue
 			}
-			words := []string{}
-			scanner := bufio.NewScanner(strings.NewReader(line))
-			scanner.Split(bufio.ScanWords)
-			if !scanner.Scan() {
-				return nil, fmt.Errorf("Error trying to use lxc-ps")
+			fields := strings.Fields(line)
+			if len(fields) <= pidIndex {
+				continue
 			}
-			// no scanner.Text because we skip container id
-			for scanner.Scan() {
-				words = append(words, scanner.Text())
+			p, err := strconv.Atoi(fields[pidIndex])
+			if err != nil {
+				return nil, fmt.Errorf("Unexpected pid '%s': %s", fields[pidIndex], err)
 			}
-			if i == 0 {
-				procs.Titles = words
-			} else {
-				procs.Processes = append(procs.Processes, words)
+			for _, pid := range pids {
+				if pid == p {
+					procs.Processes = append(procs.Processes, fields)
+					break
+				}
 			}
 		}
 		return &procs, nil
@@ -353,13 +414,19 @@ func (srv *Server) ContainerChanges(name string) ([]Change, error) {
 	return nil, fmt.Errorf("No such container: %s", name)
 }
 
-func (srv *Server) Containers(all, size bool, n int, since, before string) []APIContainers {
+// Containers lists the containers, the latest created first. The filters
+// apply before the limit n.
+func (srv *Server) Containers(all, size bool, n int, since, before string, filters Filters) ([]APIContainers, error) {
 	var foundBefore bool
 	var displayed int
 	retContainers := []APIContainers{}
 
+	ancestors, err := srv.resolveAncestors(filters)
+	if err != nil {
+		return nil, err
+	}
 	for _, container := range srv.runtime.List() {
-		if !container.State.Running && !all && n == -1 && since == "" && before == "" {
+		if !container.State.Running && !all && n == -1 && since == "" && before == "" && !filters.showsAll() {
 			continue
 		}
 		if before != "" {
@@ -371,35 +438,68 @@ func (srv *Server) Containers(all, size bool, n int, since, before string) []API
 				continue
 			}
 		}
-		if displayed == n {
+		if container.ShortID() == since {
 			break
 		}
-		if container.ShortID() == since {
+		if !filters.matchContainer(container) {
+			continue
+		}
+		if len(ancestors) > 0 {
+			image, _ := srv.runtime.graph.Get(container.Image)
+			if !filters.matchAncestors(image, ancestors) {
+				continue
+			}
+		}
+		if displayed == n {
 			break
 		}
 		displayed++
 
 		c := APIContainers{
-			ID: container.ID,
+			ID:   container.ID,
+			Name: container.Name,
 		}
 		c.Image = srv.runtime.repositories.ImageName(container.Image)
 		c.Command = fmt.Sprintf("%s %s", container.Path, strings.Join(container.Args, " "))
 		c.Created = container.Created.Unix()
 		c.Status = container.State.String()
 		c.Ports = container.NetworkSettings.PortMappingHuman()
+		c.Labels = container.Config.Labels
 		if size {
 			c.SizeRw, c.SizeRootFs = container.GetSize()
 		}
 		retContainers = append(retContainers, c)
 	}
-	return retContainers
+	return retContainers, nil
+}
+
+// resolveAncestors returns the IDs of the images of the ancestor filters.
+func (srv *Server) resolveAncestors(filters Filters) (map[string]bool, error) {
+	ancestors := make(map[string]bool)
+	for _, name := range filters["ancestor"] {
+		image, err := srv.runtime.repositories.LookupImage(name)
+		if err != nil || image == nil {
+			return nil, fmt.Errorf("No such image: %s", name)
+		}
+		ancestors[image.ID] = true
+	}
+	return ancestors, nil
 }
 
-func (srv *Server) ContainerCommit(name, repo, tag, author, comment string, config *Config) (string, error) {
+// ContainerCommit creates an image from the changes of the container name.
+// If pause is set, a running container is paused while its changes are
+// archived, so that they are consistent.
+func (srv *Server) ContainerCommit(name, repo, tag, author, comment string, pause bool, config *Config) (string, error) {
 	container := srv.runtime.Get(name)
 	if container == nil {
 		return "", fmt.Errorf("No such container: %s", name)
 	}
+	if pause && container.State.Running && !container.State.Paused {
+		if err := container.Pause(); err != nil {
+			return "", err
+		}
+		defer container.Unpause()
+	}
 	img, err := NewBuilder(srv.runtime).Commit(container, repo, tag, comment, author, config)
 	if err != nil {
 		return "", err
@@ -758,7 +858,7 @@ func (srv *Server) pushImage(r *registry.Registry, out io.Writer, remote, imgID,
 		return "", err
 	}
 
-	layerData, err := srv.runtime.graph.TempLayerArchive(imgID, Uncompressed, sf, out)
+	layerData, err := srv.runtime.graph.TempLayerArchive(imgID, sf, out)
 	if err != nil {
 		return "", fmt.Errorf("Failed to generate layer archive: %s", err)
 	}
@@ -859,7 +959,7 @@ func (srv *Server) ImageImport(src, repo, tag string, in io.Reader, out io.Write
 	return nil
 }
 
-func (srv *Server) ContainerCreate(config *Config) (string, error) {
+func (srv *Server) ContainerCreate(config *Config, name string) (string, error) {
 
 	if config.Memory != 0 && config.Memory < 524288 {
 		return "", fmt.Errorf("Memory limit must be given in bytes (minimum 524288 bytes)")
@@ -873,7 +973,7 @@ func (srv *Server) ContainerCreate(config *Config) (string, error) {
 		config.MemorySwap = -1
 	}
 	b := NewBuilder(srv.runtime)
-	container, err := b.Create(config)
+	container, err := b.Create(config, name)
 	if err != nil {
 		if srv.runtime.graph.IsNotExist(err) {
 
@@ -902,6 +1002,18 @@ func (srv *Server) ContainerRestart(name string, t int) error {
 	return nil
 }
 
+func (srv *Server) ContainerRename(name, newName string) error {
+	if container := srv.runtime.Get(name); container != nil {
+		if err := srv.runtime.Rename(container, newName); err != nil {
+			return fmt.Errorf("Error renaming container %s: %s", name, err)
+		}
+		srv.LogEvent("rename", container.ShortID(), srv.runtime.repositories.ImageName(container.Image))
+	} else {
+		return fmt.Errorf("No such container: %s", name)
+	}
+	return nil
+}
+
 func (srv *Server) ContainerDestroy(name string, removeVolume bool) error {
 	if container := srv.runtime.Get(name); container != nil {
 		if container.State.Running {
@@ -915,7 +1027,7 @@ func (srv *Server) ContainerDestroy(name string, removeVolume bool) error {
 		if err := srv.runtime.Destroy(container); err != nil {
 			return fmt.Errorf("Error destroying container %s: %s", name, err)
 		}
-		srv.LogEvent("destroy", container.ShortID(), srv.runtime.repositories.ImageName(container.Image))
+		srv.logEvent("destroy", container.ShortID(), srv.runtime.repositories.ImageName(container.Image), container.Config.Labels)
 
 		if removeVolume {
 			// Retrieve all volumes from all remaining containers
@@ -974,6 +1086,10 @@ func (srv *Server) deleteImageAndChildren(id string, imgs *[]APIRmi) error {
 		return err
 	}
 	if len(byParents[id]) == 0 {
+		var labels map[string]string
+		if image, err := srv.runtime.graph.Get(id); err == nil {
+			labels = image.labels()
+		}
 		if err := srv.runtime.repositories.DeleteAll(id); err != nil {
 			return err
 		}
@@ -982,7 +1098,7 @@ func (srv *Server) deleteImageAndChildren(id string, imgs *[]APIRmi) error {
 			return err
 		}
 		*imgs = append(*imgs, APIRmi{Deleted: utils.TruncateID(id)})
-		srv.LogEvent("delete", utils.TruncateID(id), "")
+		srv.logEvent("delete", utils.TruncateID(id), "", labels)
 		return nil
 	}
 	return nil
@@ -1115,6 +1231,30 @@ func (srv *Server) ContainerStop(name string, t int) error {
 	return nil
 }
 
+func (srv *Server) ContainerPause(name string) error {
+	container := srv.runtime.Get(name)
+	if container == nil {
+		return fmt.Errorf("No such container: %s", name)
+	}
+	if err := container.Pause(); err != nil {
+		return err
+	}
+	srv.LogEvent("pause", container.ShortID(), srv.runtime.repositories.ImageName(container.Image))
+	return nil
+}
+
+func (srv *Server) ContainerUnpause(name string) error {
+	container := srv.runtime.Get(name)
+	if container == nil {
+		return fmt.Errorf("No such container: %s", name)
+	}
+	if err := container.Unpause(); err != nil {
+		return err
+	}
+	srv.LogEvent("unpause", container.ShortID(), srv.runtime.repositories.ImageName(container.Image))
+	return nil
+}
+
 func (srv *Server) ContainerWait(name string) (int, error) {
 	if container := srv.runtime.Get(name); container != nil {
 		return container.Wait(), nil
@@ -1129,6 +1269,56 @@ func (srv *Server) ContainerResize(name string, h, w int) error {
 	return fmt.Errorf("No such container: %s", name)
 }
 
+func (srv *Server) ContainerExecCreate(name string, config *ExecConfig) (string, error) {
+	container := srv.runtime.Get(name)
+	if container == nil {
+		return "", fmt.Errorf("No such container: %s", name)
+	}
+	e, err := srv.runtime.CreateExec(container, config)
+	if err != nil {
+		return "", err
+	}
+	return e.ID, nil
+}
+
+// ContainerExecStart runs the exec id, streaming its standard streams from
+// in and to out, and returns once its process has exited.
+func (srv *Server) ContainerExecStart(id string, stdin bool, in io.ReadCloser, out io.Writer) error {
+	e := srv.runtime.GetExec(id)
+	if e == nil {
+		return fmt.Errorf("No such exec: %s", id)
+	}
+	var cStdin io.Reader
+	if stdin {
+		cStdin = in
+	}
+	if err := e.Start(cStdin, out, out); err != nil {
+		return err
+	}
+	srv.LogEvent("exec", e.container.ShortID(), srv.runtime.repositories.ImageName(e.container.Image))
+	e.Wait()
+	return nil
+}
+
+// ContainerExecWait returns the exit code of the exec id once its process
+// has exited. The exec is then forgotten.
+func (srv *Server) ContainerExecWait(id string) (int, error) {
+	e := srv.runtime.GetExec(id)
+	if e == nil {
+		return 0, fmt.Errorf("No such exec: %s", id)
+	}
+	exitCode := e.Wait()
+	srv.runtime.removeExec(id)
+	return exitCode, nil
+}
+
+func (srv *Server) ContainerExecResize(id string, h, w int) error {
+	if e := srv.runtime.GetExec(id); e != nil {
+		return e.Resize(h, w)
+	}
+	return fmt.Errorf("No such exec: %s", id)
+}
+
 func (srv *Server) ContainerAttach(name string, logs, stream, stdin, stdout, stderr bool, in io.ReadCloser, out io.Writer) error {
 	container := srv.runtime.Get(name)
 	if container == nil {
@@ -1279,9 +1469,22 @@ func (srv *Server) HTTPRequestFactory(metaHeaders map[string][]string) *utils.HT
 	return srv.reqFactory
 }
 
+// LogEvent records an event about the container or image id, and sends it
+// to the listeners of /events.
 func (srv *Server) LogEvent(action, id, from string) {
+	var labels map[string]string
+	if container := srv.runtime.Get(id); container != nil {
+		labels = container.Config.Labels
+	} else if image, err := srv.runtime.graph.Get(id); err == nil {
+		labels = image.labels()
+	}
+	srv.logEvent(action, id, from, labels)
+}
+
+// logEvent is LogEvent, for containers and images which are already gone.
+func (srv *Server) logEvent(action, id, from string, labels map[string]string) {
 	now := time.Now().Unix()
-	jm := utils.JSONMessage{Status: action, ID: id, From: from, Time: now}
+	jm := utils.JSONMessage{Status: action, ID: id, From: from, Time: now, Labels: labels}
 	srv.events = append(srv.events, jm)
 	for _, c := range srv.listeners {
 		select { // non blocking channel
@@ -2,6 +2,8 @@ package docker
 
 import (
 	"github.com/dotcloud/docker/utils"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -13,7 +15,7 @@ func TestContainerTagImageDelete(t *testing.T) {
 
 	srv := &Server{runtime: runtime}
 
-	initialImages, err := srv.Images(false, "")
+	initialImages, err := srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -29,7 +31,7 @@ func TestContainerTagImageDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	images, err := srv.Images(false, "")
+	images, err := srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -42,7 +44,7 @@ func TestContainerTagImageDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	images, err = srv.Images(false, "")
+	images, err = srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -55,7 +57,7 @@ func TestContainerTagImageDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	images, err = srv.Images(false, "")
+	images, err = srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,7 +70,7 @@ func TestContainerTagImageDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	images, err = srv.Images(false, "")
+	images, err = srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -89,7 +91,7 @@ func TestCreateRm(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	id, err := srv.ContainerCreate(config)
+	id, err := srv.ContainerCreate(config, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -119,16 +121,151 @@ func TestCommit(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	id, err := srv.ContainerCreate(config)
+	id, err := srv.ContainerCreate(config, "")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if _, err := srv.ContainerCommit(id, "testrepo", "testtag", "", "", config); err != nil {
+	if _, err := srv.ContainerCommit(id, "testrepo", "testtag", "", "", false, config); err != nil {
 		t.Fatal(err)
 	}
 }
 
+func TestContainersLabelFilter(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+
+	srv := &Server{runtime: runtime}
+
+	var ids []string
+	for _, label := range []string{"team=payments", "team=search"} {
+		config, _, _, err := ParseRun([]string{"-label", label, GetTestImage(runtime).ID, "echo test"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := srv.ContainerCreate(config, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	filters := Filters{"label": {"team=payments"}}
+	containers, err := srv.Containers(true, false, -1, "", "", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].ID != runtime.Get(ids[0]).ID {
+		t.Fatalf("Expected only %s to have the label team=payments, found %v", ids[0], containers)
+	}
+	if containers[0].Labels["team"] != "payments" {
+		t.Fatalf("Expected the labels of the container to be listed, found %v", containers[0].Labels)
+	}
+	if containers, _ := srv.Containers(true, false, -1, "", "", Filters{"label": {"team"}}); len(containers) != 2 {
+		t.Fatalf("Expected 2 containers with a team label, found %d", len(containers))
+	}
+}
+
+func TestContainersFilters(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+
+	srv := &Server{runtime: runtime}
+
+	for name, cmd := range map[string]string{"web-1": "exit 3", "db-1": "true"} {
+		config, _, _, err := ParseRun([]string{GetTestImage(runtime).ID, "sh", "-c", cmd}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := srv.ContainerCreate(config, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	web := runtime.Get("web-1")
+	if err := web.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := strconv.FormatInt(time.Now().Unix()+1, 10)
+	for _, test := range []struct {
+		filters  Filters
+		expected int
+	}{
+		{Filters{"status": {"exited"}}, 1},
+		{Filters{"status": {"created", "exited"}}, 2},
+		{Filters{"status": {"running"}}, 0},
+		{Filters{"exited": {"3"}}, 1},
+		{Filters{"exited": {"0"}}, 0},
+		{Filters{"name": {"web-*"}}, 1},
+		{Filters{"name": {"*-1"}, "status": {"created"}}, 1},
+		{Filters{"ancestor": {GetTestImage(runtime).ID}}, 2},
+		{Filters{"created-before": {now}}, 2},
+		{Filters{"created-after": {now}}, 0},
+	} {
+		list, err := srv.Containers(true, false, -1, "", "", test.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != test.expected {
+			t.Fatalf("Expected %d containers for %v, found %d", test.expected, test.filters, len(list))
+		}
+	}
+	// Filtering by state lists the stopped containers too
+	if list, _ := srv.Containers(false, false, -1, "", "", Filters{"exited": {"3"}}); len(list) != 1 || list[0].ID != web.ID {
+		t.Fatalf("Expected only %s to have exited with 3, found %v", web.ID, list)
+	}
+	if list, _ := srv.Containers(true, false, 1, "", "", Filters{"status": {"created", "exited"}}); len(list) != 1 {
+		t.Fatalf("Expected the limit to apply to the filtered containers, found %d", len(list))
+	}
+	if _, err := srv.Containers(true, false, -1, "", "", Filters{"ancestor": {"nosuchimage"}}); err == nil {
+		t.Fatalf("Expected an unknown ancestor to be an error")
+	}
+}
+
+func TestImagesFilters(t *testing.T) {
+	runtime := mkRuntime(t)
+	defer nuke(runtime)
+
+	srv := &Server{runtime: runtime}
+
+	config, _, _, err := ParseRun([]string{GetTestImage(runtime).ID, "true"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := srv.ContainerCreate(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	untagged, err := srv.ContainerCommit(id, "", "", "", "", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		filters  Filters
+		expected []string
+	}{
+		{Filters{"dangling": {"true"}}, []string{untagged}},
+		{Filters{"dangling": {"false"}}, []string{GetTestImage(runtime).ID}},
+		{Filters{"name": {unitTestImageName[:4] + "*"}}, []string{GetTestImage(runtime).ID}},
+		{Filters{"name": {"nosuchimage*"}}, nil},
+		{Filters{"ancestor": {unitTestImageName}, "dangling": {"true"}}, []string{untagged}},
+	} {
+		images, err := srv.Images(false, "", test.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(images) != len(test.expected) {
+			t.Fatalf("Expected %v for %v, found %v", test.expected, test.filters, images)
+		}
+		for i, image := range images {
+			if utils.TruncateID(image.ID) != utils.TruncateID(test.expected[i]) {
+				t.Fatalf("Expected %v for %v, found %v", test.expected, test.filters, images)
+			}
+		}
+	}
+}
+
 func TestCreateStartRestartStopStartKillRm(t *testing.T) {
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
@@ -140,7 +277,7 @@ func TestCreateStartRestartStopStartKillRm(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	id, err := srv.ContainerCreate(config)
+	id, err := srv.ContainerCreate(config, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -169,7 +306,7 @@ func TestCreateStartRestartStopStartKillRm(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = srv.ContainerKill(id)
+	err = srv.ContainerKill(id, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -197,7 +334,7 @@ func TestRunWithTooLowMemoryLimit(t *testing.T) {
 			Memory:    524287,
 			CpuShares: 1000,
 			Cmd:       []string{"/bin/cat"},
-		},
+		}, "",
 	)
 	if err == nil {
 		t.Errorf("Memory limit is smaller than the allowed limit. Container creation should've failed!")
@@ -340,7 +477,7 @@ func TestLogEvent(t *testing.T) {
 	setTimeout(t, "Listening for events timed out", 2*time.Second, func() {
 		for i := 2; i < 4; i++ {
 			event := <-listener
-			if event != srv.events[i] {
+			if !reflect.DeepEqual(event, srv.events[i]) {
 				t.Fatalf("Event received it different than expected")
 			}
 		}
@@ -348,11 +485,14 @@ func TestLogEvent(t *testing.T) {
 }
 
 func TestRmi(t *testing.T) {
+	if unitTestFake {
+		t.Skip("The fake driver fails to start commands it can't find, unlike dockerinit")
+	}
 	runtime := mkRuntime(t)
 	defer nuke(runtime)
 	srv := &Server{runtime: runtime}
 
-	initialImages, err := srv.Images(false, "")
+	initialImages, err := srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -362,7 +502,7 @@ func TestRmi(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	containerID, err := srv.ContainerCreate(config)
+	containerID, err := srv.ContainerCreate(config, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -373,7 +513,7 @@ func TestRmi(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	imageID, err := srv.ContainerCommit(containerID, "test", "", "", "", nil)
+	imageID, err := srv.ContainerCommit(containerID, "test", "", "", "", false, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -383,7 +523,7 @@ func TestRmi(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	containerID, err = srv.ContainerCreate(config)
+	containerID, err = srv.ContainerCreate(config, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -394,12 +534,12 @@ func TestRmi(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = srv.ContainerCommit(containerID, "test", "", "", "", nil)
+	_, err = srv.ContainerCommit(containerID, "test", "", "", "", false, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	images, err := srv.Images(false, "")
+	images, err := srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -413,7 +553,7 @@ func TestRmi(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	images, err = srv.Images(false, "")
+	images, err = srv.Images(false, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
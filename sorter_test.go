@@ -19,7 +19,7 @@ func TestServerListOrderedImagesByCreationDate(t *testing.T) {
 
 	srv := &Server{runtime: runtime}
 
-	images, err := srv.Images(true, "")
+	images, err := srv.Images(true, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -46,7 +46,7 @@ func TestServerListOrderedImagesByCreationDateAndTag(t *testing.T) {
 	srv.ContainerTag(image.ID, "repo", "foo", false)
 	srv.ContainerTag(image.ID, "repo", "bar", false)
 
-	images, err := srv.Images(true, "")
+	images, err := srv.Images(true, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -9,11 +9,20 @@ import (
 
 type State struct {
 	sync.Mutex
-	Running   bool
-	Pid       int
-	ExitCode  int
-	StartedAt time.Time
-	Ghost     bool
+	Running      bool
+	Pid          int
+	ExitCode     int
+	OOMKilled    bool
+	StartedAt    time.Time
+	Ghost        bool
+	Paused       bool
+	Restarting   bool
+	RestartCount int
+	Health       *Health
+
+	// Guards Health, which the health check replaces while the rest of the
+	// state may stay locked for as long as the container takes to stop
+	healthLock sync.Mutex
 }
 
 // String returns a human-readable description of the state
@@ -22,21 +31,73 @@ func (s *State) String() string {
 		if s.Ghost {
 			return fmt.Sprintf("Ghost")
 		}
+		if s.Paused {
+			return fmt.Sprintf("Up %s (Paused)", utils.HumanDuration(time.Now().Sub(s.StartedAt)))
+		}
+		if health := s.health(); health != nil {
+			return fmt.Sprintf("Up %s (%s)", utils.HumanDuration(time.Now().Sub(s.StartedAt)), health.Status)
+		}
 		return fmt.Sprintf("Up %s", utils.HumanDuration(time.Now().Sub(s.StartedAt)))
 	}
+	if s.Restarting {
+		return fmt.Sprintf("Restarting (Exit %d)", s.ExitCode)
+	}
+	if s.OOMKilled {
+		return fmt.Sprintf("Exit %d (OOM killed)", s.ExitCode)
+	}
 	return fmt.Sprintf("Exit %d", s.ExitCode)
 }
 
+// status returns the state as one of created, running, paused, restarting
+// and exited, for the status filter of the containers.
+func (s *State) status() string {
+	switch {
+	case s.Running && s.Paused:
+		return "paused"
+	case s.Running:
+		return "running"
+	case s.Restarting:
+		return "restarting"
+	case s.StartedAt.IsZero():
+		return "created"
+	}
+	return "exited"
+}
+
 func (s *State) setRunning(pid int) {
 	s.Running = true
 	s.Ghost = false
+	s.Paused = false
+	s.Restarting = false
+	s.setHealth(nil)
 	s.ExitCode = 0
+	s.OOMKilled = false
 	s.Pid = pid
 	s.StartedAt = time.Now()
 }
 
+// health returns a copy of the health of the state, nil if the container
+// has no health check.
+func (s *State) health() *Health {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	if s.Health == nil {
+		return nil
+	}
+	health := *s.Health
+	health.Log = append([]*HealthResult(nil), s.Health.Log...)
+	return &health
+}
+
+func (s *State) setHealth(health *Health) {
+	s.healthLock.Lock()
+	s.Health = health
+	s.healthLock.Unlock()
+}
+
 func (s *State) setStopped(exitCode int) {
 	s.Running = false
+	s.Paused = false
 	s.Pid = 0
 	s.ExitCode = exitCode
 }
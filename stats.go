@@ -0,0 +1,152 @@
+package docker
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats returns a sample of the resource usage of the container, read from
+// the control groups of its first process and from the network interfaces
+// of its namespace.
+func (container *Container) Stats() (*APIStats, error) {
+	if !container.State.Running {
+		return nil, fmt.Errorf("Impossible to get the stats of container %s: it is not running", container.ID)
+	}
+	info, err := container.runtime.execDriver.Info(container)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Running || info.Pid == 0 {
+		return nil, fmt.Errorf("Impossible to get the stats of container %s: it is not running", container.ID)
+	}
+
+	stats := &APIStats{Read: time.Now()}
+	// A subsystem which is not mounted leaves its counters to 0
+	if dir, err := processCgroupPath("memory", info.Pid); err != nil {
+		utils.Debugf("Skipping memory stats: %s", err)
+	} else {
+		if stats.MemoryUsage, err = readCgroupUint(dir, "memory.usage_in_bytes"); err != nil {
+			return nil, err
+		}
+		if stats.MemoryLimit, err = readCgroupUint(dir, "memory.limit_in_bytes"); err != nil {
+			return nil, err
+		}
+		if stats.MemoryFailcnt, err = readCgroupUint(dir, "memory.failcnt"); err != nil {
+			return nil, err
+		}
+		// Without a limit, the one reported is far above the memory of the host
+		if total := hostMemory(); total != 0 && stats.MemoryLimit > total {
+			stats.MemoryLimit = total
+		}
+	}
+	if dir, err := processCgroupPath("cpuacct", info.Pid); err != nil {
+		utils.Debugf("Skipping cpu stats: %s", err)
+	} else if stats.CPUUsage, err = readCgroupUint(dir, "cpuacct.usage"); err != nil {
+		return nil, err
+	}
+	if dir, err := processCgroupPath("blkio", info.Pid); err != nil {
+		utils.Debugf("Skipping blkio stats: %s", err)
+	} else if err := readBlkioStats(dir, stats); err != nil {
+		return nil, err
+	}
+	if err := readNetworkStats(info.Pid, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// readBlkioStats sums the bytes read and written on all devices, which are
+// accounted whatever the I/O scheduler.
+func readBlkioStats(dir string, stats *APIStats) error {
+	f, err := os.Open(path.Join(dir, "blkio.throttle.io_service_bytes"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	// Lines are made of the device, the operation and the number of bytes,
+	// e.g. 8:0 Read 4096
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Error parsing blkio stats: %s", err)
+		}
+		switch fields[1] {
+		case "Read":
+			stats.BlkioRead += value
+		case "Write":
+			stats.BlkioWrite += value
+		}
+	}
+	return scanner.Err()
+}
+
+// readNetworkStats sums the counters of the network interfaces of the
+// namespace of pid, but the loopback. They are seen from inside the
+// container: the host end of its veth pair has them reversed.
+func readNetworkStats(pid int, stats *APIStats) error {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		// Skip the two title lines
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "lo" {
+			continue
+		}
+		// 8 receive counters, then 8 transmit ones, bytes and packets first
+		fields := strings.Fields(parts[1])
+		if len(fields) < 10 {
+			continue
+		}
+		var counters [4]uint64
+		for i, field := range []string{fields[0], fields[1], fields[8], fields[9]} {
+			if counters[i], err = strconv.ParseUint(field, 10, 64); err != nil {
+				return fmt.Errorf("Error parsing network stats: %s", err)
+			}
+		}
+		stats.RxBytes += counters[0]
+		stats.RxPackets += counters[1]
+		stats.TxBytes += counters[2]
+		stats.TxPackets += counters[3]
+	}
+	return scanner.Err()
+}
+
+// hostMemory returns the total memory of the host in bytes, or 0 if unknown.
+func hostMemory() uint64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:        8048816 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" {
+			total, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return total * 1024
+		}
+	}
+	return 0
+}
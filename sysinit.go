@@ -4,12 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"unsafe"
 )
 
 // Setup networking
@@ -31,31 +34,124 @@ func setupWorkingDirectory(workdir string) {
 }
 
 
-// Takes care of dropping privileges to the desired user
+// Takes care of dropping privileges to the desired user, given as
+// user[:group] by name or id. Ids don't need to be in /etc/passwd or
+// /etc/group. The user also gets its supplementary groups, and HOME is its
+// home directory unless set already.
 func changeUser(u string) {
 	if u == "" {
+		// Keep the privileges of root, which may not be allowed to
+		// change its groups
+		if userent, err := utils.UserLookup("0"); err == nil {
+			setupHome(userent.HomeDir)
+		} else {
+			setupHome("/")
+		}
 		return
 	}
-	userent, err := utils.UserLookup(u)
+	uid, gid, groups, home, err := lookupUser(u)
 	if err != nil {
-		log.Fatalf("Unable to find user %v: %v", u, err)
+		log.Fatal(err)
 	}
-
-	uid, err := strconv.Atoi(userent.Uid)
-	if err != nil {
-		log.Fatalf("Invalid uid: %v", userent.Uid)
-	}
-	gid, err := strconv.Atoi(userent.Gid)
-	if err != nil {
-		log.Fatalf("Invalid gid: %v", userent.Gid)
+	if err := syscall.Setgroups(groups); err != nil {
+		log.Fatalf("setgroups failed: %v", err)
 	}
-
 	if err := syscall.Setgid(gid); err != nil {
 		log.Fatalf("setgid failed: %v", err)
 	}
 	if err := syscall.Setuid(uid); err != nil {
 		log.Fatalf("setuid failed: %v", err)
 	}
+	setupHome(home)
+}
+
+// lookupUser resolves u, a user with an optional group (user[:group]), in
+// /etc/passwd and /etc/group. Unknown numeric ids are used as they are, an
+// unknown uid getting the gid of the same number.
+func lookupUser(u string) (uid, gid int, groups []int, home string, err error) {
+	name, group := u, ""
+	if parts := strings.SplitN(u, ":", 2); len(parts) == 2 {
+		name, group = parts[0], parts[1]
+	}
+	if name == "" {
+		name = "0"
+	}
+
+	home = "/"
+	if userent, lookupErr := utils.UserLookup(name); lookupErr == nil {
+		if uid, err = strconv.Atoi(userent.Uid); err != nil {
+			return 0, 0, nil, "", fmt.Errorf("Invalid uid: %v", userent.Uid)
+		}
+		if gid, err = strconv.Atoi(userent.Gid); err != nil {
+			return 0, 0, nil, "", fmt.Errorf("Invalid gid: %v", userent.Gid)
+		}
+		home = userent.HomeDir
+		// A missing /etc/group just means no supplementary groups
+		memberOf, _ := utils.UserGroups(userent.Username)
+		for _, groupent := range memberOf {
+			if id, err := strconv.Atoi(groupent.Gid); err == nil {
+				groups = append(groups, id)
+			}
+		}
+	} else if id, convErr := strconv.Atoi(name); convErr == nil {
+		// Not the group of root, which a zero gid would be
+		uid, gid = id, id
+	} else {
+		return 0, 0, nil, "", fmt.Errorf("Unable to find user %v: %v", name, lookupErr)
+	}
+	if group != "" {
+		if groupent, lookupErr := utils.GroupLookup(group); lookupErr == nil {
+			if gid, err = strconv.Atoi(groupent.Gid); err != nil {
+				return 0, 0, nil, "", fmt.Errorf("Invalid gid: %v", groupent.Gid)
+			}
+		} else if id, convErr := strconv.Atoi(group); convErr == nil {
+			gid = id
+		} else {
+			return 0, 0, nil, "", fmt.Errorf("Unable to find group %v: %v", group, lookupErr)
+		}
+	}
+	return uid, gid, groups, home, nil
+}
+
+// Set HOME, unless the container or the image did
+func setupHome(home string) {
+	if os.Getenv("HOME") == "" {
+		os.Setenv("HOME", home)
+	}
+}
+
+// Resource numbers of Linux for setrlimit(2), by the names given to run -ulimit
+var ulimitResources = map[string]int{
+	"as":         9,
+	"core":       4,
+	"cpu":        0,
+	"data":       2,
+	"fsize":      1,
+	"locks":      10,
+	"memlock":    8,
+	"msgqueue":   12,
+	"nice":       13,
+	"nofile":     7,
+	"nproc":      6,
+	"rss":        5,
+	"rtprio":     14,
+	"rttime":     15,
+	"sigpending": 11,
+	"stack":      3,
+}
+
+// Set the resource limits, while still allowed to raise them
+func setupUlimits(ulimits ListOpts) {
+	for _, value := range ulimits {
+		ulimit, err := parseUlimit(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rlimit := &syscall.Rlimit{Cur: uint64(ulimit.Soft), Max: uint64(ulimit.Hard)}
+		if err := syscall.Setrlimit(ulimitResources[ulimit.Name], rlimit); err != nil {
+			log.Fatalf("Unable to set the %s limit: %v", ulimit.Name, err)
+		}
+	}
 }
 
 // Clear environment pollution introduced by lxc-start
@@ -82,6 +178,123 @@ func executeProgram(name string, args []string) {
 	}
 }
 
+// runInit stays the first process of the container while the program runs
+// as its child, so that the program gets the signals sent to the container
+// and the processes it leaves behind get reaped. It exits like the program,
+// whose exit status it records in status first if given.
+//
+// Without withInit, the program is still treated as the init of the
+// container: the signals it has no handler for are not forwarded, as the
+// kernel wouldn't deliver them to the process 1 either.
+func runInit(name string, args []string, withInit bool, status *os.File) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		exitProgram(status, 127, "Unable to locate %v", name)
+	}
+
+	// All of them, such as the stop signal of the container or the real-time
+	// ones. The program restores the default handlers when it starts.
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals)
+
+	cmd := exec.Command(path)
+	cmd.Args = args
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// In its own process group, the program doesn't get the signals of
+	// the tty twice, once from the tty and once from us
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		exitProgram(status, 126, "Unable to start %v: %v", name, err)
+	}
+	pid := cmd.Process.Pid
+	// Give it the tty, if stdin is one
+	pgrp := int32(pid)
+	syscall.Syscall(syscall.SYS_IOCTL, 0, syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&pgrp)))
+
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGCHLD:
+			reapChildren(pid, status)
+		case syscall.SIGURG:
+			// Sent by the Go runtime to preempt its goroutines, not meant
+			// for the program
+		default:
+			if withInit || catchesSignal(pid, sig.(syscall.Signal)) {
+				syscall.Kill(pid, sig.(syscall.Signal))
+			}
+		}
+	}
+}
+
+// reapChildren waits for the children which exited, several of which may
+// have for one SIGCHLD, and exits like pid if it is one of them.
+func reapChildren(pid int, status *os.File) {
+	for {
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err != nil || wpid <= 0 {
+			return
+		}
+		if wpid != pid {
+			continue
+		}
+		if ws.Signaled() {
+			exitProgram(status, 128+int(ws.Signal()), "")
+		}
+		exitProgram(status, ws.ExitStatus(), "")
+	}
+}
+
+// exitProgram exits with code, the exit status of the program, after
+// recording it in status if given. A non empty format is logged first.
+func exitProgram(status *os.File, code int, format string, v ...interface{}) {
+	if format != "" {
+		log.Printf(format, v...)
+	}
+	if status != nil {
+		fmt.Fprintf(status, "%d\n", code)
+		status.Close()
+	}
+	os.Exit(code)
+}
+
+// catchesSignal tells whether the process pid has a handler for sig, from
+// the SigCgt mask of its status in /proc.
+func catchesSignal(pid int, sig syscall.Signal) bool {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "SigCgt:") {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "SigCgt:")), 16, 64)
+		return err == nil && mask&(1<<uint(sig-1)) != 0
+	}
+	return false
+}
+
+// The native execution driver runs dockerinit straight from the host's
+// filesystem, with this flag as first argument. Processes started in running
+// containers go through dockerinit on the host with nativeExecFlag first.
+const (
+	nativeInitFlag = "-native"
+	nativeExecFlag = "-native-exec"
+)
+
+// IsSysInit returns true if the current process has to run SysInit, either
+// because it was started as dockerinit by lxc-start or by the native
+// execution driver.
+func IsSysInit() bool {
+	if selfPath := utils.SelfPath(); selfPath == "/sbin/init" || selfPath == "/.dockerinit" {
+		return true
+	}
+	return len(os.Args) > 1 && (os.Args[1] == nativeInitFlag || os.Args[1] == nativeExecFlag)
+}
+
 // Sys Init code
 // This code is run INSIDE the container and is responsible for setting
 // up the environment before running the actual process
@@ -90,18 +303,59 @@ func SysInit() {
 		fmt.Println("You should not invoke docker-init manually")
 		os.Exit(1)
 	}
+	if os.Args[1] == nativeExecFlag {
+		if len(os.Args) < 4 {
+			log.Fatalf("Usage: %s %s ID PID [ARG...]", os.Args[0], nativeExecFlag)
+		}
+		if err := nativeExec(os.Args[2], os.Args[3], os.Args[4:]); err != nil {
+			log.Fatalf("Unable to enter the container: %s", err)
+		}
+	}
 	var u = flag.String("u", "", "username or uid")
 	var gw = flag.String("g", "", "gateway address")
 	var workdir = flag.String("w", "", "workdir")
+	var native = flag.Bool("native", false, "set up the container started by the native execution driver")
+	var dropCaps = flag.String("dropcaps", "", "capabilities to drop, separated by commas")
+	var withInit = flag.Bool("init", false, "run the program as a child, forwarding signals and reaping processes")
+	var exitStatus = flag.Bool("exitstatus", false, "run the program as a child, recording its exit status in /.dockerexit")
 
 	var flEnv ListOpts
 	flag.Var(&flEnv, "e", "Set environment variables")
 
+	var flUlimits ListOpts
+	flag.Var(&flUlimits, "ulimit", "Set resource limits")
+
 	flag.Parse()
 
 	cleanupEnv(flEnv)
-	setupNetworking(*gw)
+	if *native {
+		// The native driver sets up the namespaces and the network
+		// before the root filesystem of the container is entered.
+		if err := setupNativeContainer(); err != nil {
+			log.Fatalf("Unable to set up the container: %s", err)
+		}
+	} else {
+		setupNetworking(*gw)
+	}
+	setupUlimits(flUlimits)
+	if *dropCaps != "" {
+		if err := dropCapabilities(strings.Split(*dropCaps, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Opened while still root, which the user of the program may not be
+	var status *os.File
+	if *exitStatus {
+		f, err := os.OpenFile("/.dockerexit", os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			log.Fatalf("Unable to open the exit status file: %s", err)
+		}
+		status = f
+	}
 	setupWorkingDirectory(*workdir)
 	changeUser(*u)
+	if *withInit || *exitStatus {
+		runInit(flag.Arg(0), flag.Args(), *withInit, status)
+	}
 	executeProgram(flag.Arg(0), flag.Args())
 }
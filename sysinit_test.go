@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"github.com/dotcloud/docker/utils"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLookupUser(t *testing.T) {
+	if _, err := utils.UserLookup("54321"); err == nil {
+		t.Skip("uid 54321 exists on this host")
+	}
+	uid, gid, groups, home, err := lookupUser("54321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != 54321 || gid != 54321 || len(groups) != 0 || home != "/" {
+		t.Fatalf("Unexpected user for an unknown uid: %d:%d %v %s", uid, gid, groups, home)
+	}
+	if _, gid, _, _, err := lookupUser("54321:4242"); err != nil || gid != 4242 {
+		t.Fatalf("The group should win over the default gid: %d (%v)", gid, err)
+	}
+	if _, _, _, _, err := lookupUser("54321:nosuchgroup"); err == nil {
+		t.Fatalf("Looking up an unknown group should fail")
+	}
+	if _, _, _, _, err := lookupUser("nosuchuser"); err == nil {
+		t.Fatalf("Looking up an unknown user should fail")
+	}
+
+	userent, err := utils.UserLookup("0")
+	if err != nil {
+		t.Skip("root is not in /etc/passwd")
+	}
+	if uid, gid, _, home, err := lookupUser(":0"); err != nil || uid != 0 || gid != 0 || home != userent.HomeDir {
+		t.Fatalf("Unexpected user for root: %d:%d %s (%v)", uid, gid, home, err)
+	}
+}
+
+func TestCatchesSignal(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "trap 'exit 0' USR1; while true; do sleep 0.1; done")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	setTimeout(t, "The handler of the shell was not found", 2*time.Second, func() {
+		for !catchesSignal(cmd.Process.Pid, syscall.SIGUSR1) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	if catchesSignal(cmd.Process.Pid, syscall.SIGUSR2) {
+		t.Fatalf("The shell has no handler for SIGUSR2")
+	}
+}
@@ -2,6 +2,8 @@ package docker
 
 import (
 	"fmt"
+	"path"
+	"strconv"
 	"strings"
 )
 
@@ -18,13 +20,28 @@ func CompareConfig(a, b *Config) bool {
 		a.Memory != b.Memory ||
 		a.MemorySwap != b.MemorySwap ||
 		a.CpuShares != b.CpuShares ||
+		a.CpusetCpus != b.CpusetCpus ||
+		a.CpusetMems != b.CpusetMems ||
+		a.BlkioWeight != b.BlkioWeight ||
+		a.PidsLimit != b.PidsLimit ||
 		a.OpenStdin != b.OpenStdin ||
 		a.Tty != b.Tty ||
+		a.Init != b.Init ||
+		a.StopSignal != b.StopSignal ||
 		a.VolumesFrom != b.VolumesFrom {
 		return false
 	}
+	if len(a.Labels) != len(b.Labels) {
+		return false
+	}
+	for key, value := range a.Labels {
+		if other, exists := b.Labels[key]; !exists || other != value {
+			return false
+		}
+	}
 	if len(a.Cmd) != len(b.Cmd) ||
 		len(a.Dns) != len(b.Dns) ||
+		len(a.DnsSearch) != len(b.DnsSearch) ||
 		len(a.Env) != len(b.Env) ||
 		len(a.PortSpecs) != len(b.PortSpecs) ||
 		len(a.Entrypoint) != len(b.Entrypoint) ||
@@ -42,6 +59,11 @@ func CompareConfig(a, b *Config) bool {
 			return false
 		}
 	}
+	for i := 0; i < len(a.DnsSearch); i++ {
+		if a.DnsSearch[i] != b.DnsSearch[i] {
+			return false
+		}
+	}
 	for i := 0; i < len(a.Env); i++ {
 		if a.Env[i] != b.Env[i] {
 			return false
@@ -62,6 +84,22 @@ func CompareConfig(a, b *Config) bool {
 			return false
 		}
 	}
+	if (a.Healthcheck == nil) != (b.Healthcheck == nil) {
+		return false
+	}
+	if a.Healthcheck != nil {
+		if a.Healthcheck.Interval != b.Healthcheck.Interval ||
+			a.Healthcheck.Timeout != b.Healthcheck.Timeout ||
+			a.Healthcheck.Retries != b.Healthcheck.Retries ||
+			len(a.Healthcheck.Test) != len(b.Healthcheck.Test) {
+			return false
+		}
+		for i := 0; i < len(a.Healthcheck.Test); i++ {
+			if a.Healthcheck.Test[i] != b.Healthcheck.Test[i] {
+				return false
+			}
+		}
+	}
 	return true
 }
 
@@ -78,6 +116,21 @@ func MergeConfig(userConf, imageConf *Config) {
 	if userConf.CpuShares == 0 {
 		userConf.CpuShares = imageConf.CpuShares
 	}
+	if userConf.CpusetCpus == "" {
+		userConf.CpusetCpus = imageConf.CpusetCpus
+	}
+	if userConf.CpusetMems == "" {
+		userConf.CpusetMems = imageConf.CpusetMems
+	}
+	if userConf.BlkioWeight == 0 {
+		userConf.BlkioWeight = imageConf.BlkioWeight
+	}
+	if userConf.PidsLimit == 0 {
+		userConf.PidsLimit = imageConf.PidsLimit
+	}
+	if len(userConf.Ulimits) == 0 {
+		userConf.Ulimits = imageConf.Ulimits
+	}
 	if userConf.PortSpecs == nil || len(userConf.PortSpecs) == 0 {
 		userConf.PortSpecs = imageConf.PortSpecs
 	} else {
@@ -130,6 +183,9 @@ func MergeConfig(userConf, imageConf *Config) {
 		//duplicates aren't an issue here
 		userConf.Dns = append(userConf.Dns, imageConf.Dns...)
 	}
+	if len(userConf.DnsSearch) == 0 {
+		userConf.DnsSearch = imageConf.DnsSearch
+	}
 	if userConf.Entrypoint == nil || len(userConf.Entrypoint) == 0 {
 		userConf.Entrypoint = imageConf.Entrypoint
 	}
@@ -139,6 +195,23 @@ func MergeConfig(userConf, imageConf *Config) {
 	if userConf.VolumesFrom == "" {
 		userConf.VolumesFrom = imageConf.VolumesFrom
 	}
+	if !userConf.Init {
+		userConf.Init = imageConf.Init
+	}
+	if userConf.StopSignal == "" {
+		userConf.StopSignal = imageConf.StopSignal
+	}
+	// The labels of the image are kept, unless the user changes them
+	if len(imageConf.Labels) > 0 {
+		if userConf.Labels == nil {
+			userConf.Labels = make(map[string]string)
+		}
+		for key, value := range imageConf.Labels {
+			if _, exists := userConf.Labels[key]; !exists {
+				userConf.Labels[key] = value
+			}
+		}
+	}
 	if userConf.Volumes == nil || len(userConf.Volumes) == 0 {
 		userConf.Volumes = imageConf.Volumes
 	} else {
@@ -146,6 +219,23 @@ func MergeConfig(userConf, imageConf *Config) {
 			userConf.Volumes[k] = v
 		}
 	}
+	if userConf.Healthcheck == nil {
+		userConf.Healthcheck = imageConf.Healthcheck
+	} else if image := imageConf.Healthcheck; image != nil {
+		// Options given without a command apply to the check of the image
+		if len(userConf.Healthcheck.Test) == 0 {
+			userConf.Healthcheck.Test = image.Test
+		}
+		if userConf.Healthcheck.Interval == 0 {
+			userConf.Healthcheck.Interval = image.Interval
+		}
+		if userConf.Healthcheck.Timeout == 0 {
+			userConf.Healthcheck.Timeout = image.Timeout
+		}
+		if userConf.Healthcheck.Retries == 0 {
+			userConf.Healthcheck.Retries = image.Retries
+		}
+	}
 }
 
 func parseLxcConfOpts(opts ListOpts) ([]KeyValuePair, error) {
@@ -167,3 +257,240 @@ func parseLxcOpt(opt string) (string, string, error) {
 	}
 	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
 }
+
+// parseRestartPolicy parses the policy given to run -restart, in the form
+// no, always or on-failure[:max-retry].
+func parseRestartPolicy(policy string) (RestartPolicy, error) {
+	parts := strings.SplitN(policy, ":", 2)
+	p := RestartPolicy{Name: parts[0]}
+	switch p.Name {
+	case "", "no", "always":
+		if len(parts) == 2 {
+			return RestartPolicy{}, fmt.Errorf("Maximum retry count can only be set with the on-failure restart policy")
+		}
+	case "on-failure":
+		if len(parts) == 2 {
+			count, err := strconv.Atoi(parts[1])
+			if err != nil || count < 0 {
+				return RestartPolicy{}, fmt.Errorf("Invalid maximum retry count: %s", parts[1])
+			}
+			p.MaximumRetryCount = count
+		}
+	default:
+		return RestartPolicy{}, fmt.Errorf("Invalid restart policy: %s", p.Name)
+	}
+	return p, nil
+}
+
+// parseHealthcheck returns the health check given to run, or nil if none of
+// its options are set. The command is run by /bin/sh -c.
+func parseHealthcheck(command string, interval, timeout, retries int, disable bool) (*HealthConfig, error) {
+	if interval < 0 || timeout < 0 || retries < 0 {
+		return nil, fmt.Errorf("Invalid health check: the interval, timeout and retries can't be negative")
+	}
+	if disable {
+		if command != "" || interval != 0 || timeout != 0 || retries != 0 {
+			return nil, fmt.Errorf("Conflicting options: -no-healthcheck and the other health check options")
+		}
+		return &HealthConfig{Test: []string{"NONE"}}, nil
+	}
+	if command == "" && interval == 0 && timeout == 0 && retries == 0 {
+		return nil, nil
+	}
+	config := &HealthConfig{Interval: interval, Timeout: timeout, Retries: retries}
+	if command != "" {
+		config.Test = []string{"/bin/sh", "-c", command}
+	}
+	return config, nil
+}
+
+// parseThrottleDevice parses the value of run -device-read-bps and
+// -device-write-bps, in the form /dev/sda:1048576.
+func parseThrottleDevice(value string) (ThrottleDevice, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "/dev/") {
+		return ThrottleDevice{}, fmt.Errorf("Invalid device rate: %s (expected /dev/device:bytes)", value)
+	}
+	rate, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || rate == 0 {
+		return ThrottleDevice{}, fmt.Errorf("Invalid device rate: %s", parts[1])
+	}
+	return ThrottleDevice{Path: parts[0], Rate: rate}, nil
+}
+
+// parseDevice parses the value of run -device, in the form
+// /dev/host[:/dev/container[:permissions]]. The device keeps its path in the
+// container, and all the permissions (rwm), by default.
+func parseDevice(value string) (DeviceMapping, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return DeviceMapping{}, fmt.Errorf("Invalid device: %s (expected /dev/host[:/dev/container[:rwm]])", value)
+	}
+	device := DeviceMapping{
+		PathOnHost:        parts[0],
+		PathInContainer:   parts[0],
+		CgroupPermissions: "rwm",
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		device.PathInContainer = parts[1]
+	}
+	if len(parts) > 2 {
+		device.CgroupPermissions = parts[2]
+	}
+	for _, p := range []string{device.PathOnHost, device.PathInContainer} {
+		if !path.IsAbs(p) || path.Clean(p) == "/" {
+			return DeviceMapping{}, fmt.Errorf("Invalid device path: %s", p)
+		}
+	}
+	// The node is created in the /dev of the container, which it gets anew
+	// each time it starts
+	if !strings.HasPrefix(path.Clean(device.PathInContainer), "/dev/") {
+		return DeviceMapping{}, fmt.Errorf("Invalid device path: %s (expected below /dev)", device.PathInContainer)
+	}
+	if device.CgroupPermissions == "" {
+		return DeviceMapping{}, fmt.Errorf("Invalid device permissions: %s", value)
+	}
+	for _, c := range device.CgroupPermissions {
+		if !strings.ContainsRune("rwm", c) || strings.Count(device.CgroupPermissions, string(c)) > 1 {
+			return DeviceMapping{}, fmt.Errorf("Invalid device permissions: %s", device.CgroupPermissions)
+		}
+	}
+	return device, nil
+}
+
+// parseTmpfs parses the value of run -tmpfs, in the form /path[:options],
+// with the options of mount -t tmpfs, e.g. /run:size=64m,mode=755.
+func parseTmpfs(value string) (string, string, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if !path.IsAbs(parts[0]) || path.Clean(parts[0]) == "/" {
+		return "", "", fmt.Errorf("Invalid tmpfs path: %s", parts[0])
+	}
+	options := ""
+	if len(parts) == 2 {
+		options = parts[1]
+	}
+	return path.Clean(parts[0]), options, nil
+}
+
+// tmpfsOptions returns the mount options of a tmpfs given to run -tmpfs:
+// nosuid, nodev and noexec, unless options say otherwise.
+func tmpfsOptions(options string) string {
+	if options == "" {
+		return "nosuid,nodev,noexec"
+	}
+	return "nosuid,nodev,noexec," + options
+}
+
+// parseLabels parses the values of run -label, in the form key=value, or key
+// for an empty value.
+func parseLabels(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if parts[0] == "" {
+			return nil, fmt.Errorf("Invalid label: %s (expected key=value)", value)
+		}
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
+
+// Signals by the names given to run -stop-signal and kill -s, with their
+// numbers on Linux, see signal(7).
+var signalNumbers = map[string]int{
+	"HUP":    1,
+	"INT":    2,
+	"QUIT":   3,
+	"ILL":    4,
+	"TRAP":   5,
+	"ABRT":   6,
+	"IOT":    6,
+	"BUS":    7,
+	"FPE":    8,
+	"KILL":   9,
+	"USR1":   10,
+	"SEGV":   11,
+	"USR2":   12,
+	"PIPE":   13,
+	"ALRM":   14,
+	"TERM":   15,
+	"STKFLT": 16,
+	"CHLD":   17,
+	"CONT":   18,
+	"STOP":   19,
+	"TSTP":   20,
+	"TTIN":   21,
+	"TTOU":   22,
+	"URG":    23,
+	"XCPU":   24,
+	"XFSZ":   25,
+	"VTALRM": 26,
+	"PROF":   27,
+	"WINCH":  28,
+	"IO":     29,
+	"PWR":    30,
+	"SYS":    31,
+}
+
+// parseSignal parses a signal given by name, with or without the SIG
+// prefix, or by number: SIGQUIT, quit and 3 are the same.
+func parseSignal(value string) (int, error) {
+	if sig, err := strconv.Atoi(value); err == nil {
+		// Up to the last real-time signal
+		if sig <= 0 || sig > 64 {
+			return 0, fmt.Errorf("Invalid signal: %s", value)
+		}
+		return sig, nil
+	}
+	sig, exists := signalNumbers[strings.TrimPrefix(strings.ToUpper(value), "SIG")]
+	if !exists {
+		return 0, fmt.Errorf("Invalid signal: %s", value)
+	}
+	return sig, nil
+}
+
+// parseUlimit parses the value of run -ulimit, in the form name=soft[:hard].
+// The hard limit defaults to the soft one.
+func parseUlimit(value string) (Ulimit, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return Ulimit{}, fmt.Errorf("Invalid ulimit: %s (expected name=soft[:hard])", value)
+	}
+	if _, exists := ulimitResources[parts[0]]; !exists {
+		return Ulimit{}, fmt.Errorf("Invalid ulimit: unknown resource %s", parts[0])
+	}
+	limits := strings.Split(parts[1], ":")
+	if len(limits) > 2 {
+		return Ulimit{}, fmt.Errorf("Invalid ulimit: %s (expected name=soft[:hard])", value)
+	}
+	ulimit := Ulimit{Name: parts[0]}
+	var err error
+	if ulimit.Soft, err = strconv.ParseInt(limits[0], 10, 64); err != nil || ulimit.Soft < 0 {
+		return Ulimit{}, fmt.Errorf("Invalid ulimit: %s", value)
+	}
+	ulimit.Hard = ulimit.Soft
+	if len(limits) == 2 {
+		if ulimit.Hard, err = strconv.ParseInt(limits[1], 10, 64); err != nil || ulimit.Hard < ulimit.Soft {
+			return Ulimit{}, fmt.Errorf("Invalid ulimit: %s (the soft limit can't exceed the hard one)", value)
+		}
+	}
+	return ulimit, nil
+}
+
+// parseLink parses the link given to run -link, in the form name:alias.
+func parseLink(link string) (name, alias string, err error) {
+	parts := strings.Split(link, ":")
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("Invalid link: %s (expected name:alias)", link)
+	}
+	if !validContainerName.MatchString(parts[1]) {
+		return "", "", fmt.Errorf("Invalid link alias: %s", parts[1])
+	}
+	return parts[0], parts[1], nil
+}
@@ -634,12 +634,24 @@ type JSONMessage struct {
 	From         string     `json:"from,omitempty"`
 	Time         int64      `json:"time,omitempty"`
 	Error        *JSONError `json:"errorDetail,omitempty"`
+	// Of the container or the image of an event
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 func (e *JSONError) Error() string {
 	return e.Message
 }
 
+// StatusError reports that a command completed with a non-zero status,
+// which the client exits with.
+type StatusError struct {
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Status: %d", e.Status)
+}
+
 func NewHTTPRequestError(msg string, res *http.Response) error {
 	return &JSONError{
 		Message: msg,
@@ -873,3 +885,65 @@ func UserLookup(uid string) (*user.User, error) {
 	}
 	return nil, fmt.Errorf("User not found in /etc/passwd")
 }
+
+// Group is an entry of /etc/group.
+type Group struct {
+	Name    string
+	Gid     string
+	Members []string
+}
+
+// ParseGroups parses the content of /etc/group. Lines which are not
+// entries, such as comments, are skipped.
+func ParseGroups(data []byte) []*Group {
+	var groups []*Group
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) != 4 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		group := &Group{Name: fields[0], Gid: fields[2]}
+		for _, member := range strings.Split(fields[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				group.Members = append(group.Members, member)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// GroupLookup check if the given group name or gid is present in /etc/group
+// and returns the group struct.
+// If the group is not found, an error is returned.
+func GroupLookup(gid string) (*Group, error) {
+	file, err := ioutil.ReadFile("/etc/group")
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range ParseGroups(file) {
+		if group.Name == gid || group.Gid == gid {
+			return group, nil
+		}
+	}
+	return nil, fmt.Errorf("Group not found in /etc/group")
+}
+
+// UserGroups returns the groups of /etc/group which list username as one
+// of their members, i.e. its supplementary groups.
+func UserGroups(username string) ([]*Group, error) {
+	file, err := ioutil.ReadFile("/etc/group")
+	if err != nil {
+		return nil, err
+	}
+	var groups []*Group
+	for _, group := range ParseGroups(file) {
+		for _, member := range group.Members {
+			if member == username {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	return groups, nil
+}
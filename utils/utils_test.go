@@ -338,6 +338,27 @@ search dotcloud.net`: true,
 	}
 }
 
+func TestParseGroups(t *testing.T) {
+	groups := ParseGroups([]byte(`root:x:0:
+# comment
+adm:x:4:syslog,www-data
+broken:x:5
+www-data:x:33:
+video:x:44: www-data `))
+	if len(groups) != 4 {
+		t.Fatalf("Expected 4 groups, found %d", len(groups))
+	}
+	if g := groups[1]; g.Name != "adm" || g.Gid != "4" || len(g.Members) != 2 || g.Members[1] != "www-data" {
+		t.Fatalf("Unexpected group: %v", g)
+	}
+	if g := groups[2]; g.Name != "www-data" || len(g.Members) != 0 {
+		t.Fatalf("Unexpected group: %v", g)
+	}
+	if g := groups[3]; len(g.Members) != 1 || g.Members[0] != "www-data" {
+		t.Fatalf("Unexpected group: %v", g)
+	}
+}
+
 func assertParseRelease(t *testing.T, release string, b *KernelVersionInfo, result int) {
 	var (
 		a *KernelVersionInfo
@@ -101,7 +101,7 @@ func mkContainer(r *Runtime, args []string, t *testing.T) (*Container, *HostConf
 	if config.Image == "_" {
 		config.Image = GetTestImage(r).ID
 	}
-	c, err := NewBuilder(r).Create(config)
+	c, err := NewBuilder(r).Create(config, "")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -207,6 +207,8 @@ func TestMergeConfig(t *testing.T) {
 		Env:         []string{"VAR1=1", "VAR2=2"},
 		VolumesFrom: "1111",
 		Volumes:     volumesImage,
+		Init:        true,
+		Labels:      map[string]string{"team": "payments", "tier": "backend"},
 	}
 
 	volumesUser := make(map[string]struct{})
@@ -216,6 +218,7 @@ func TestMergeConfig(t *testing.T) {
 		PortSpecs: []string{"3333:2222", "3333:3333"},
 		Env:       []string{"VAR2=3", "VAR3=3"},
 		Volumes:   volumesUser,
+		Labels:    map[string]string{"tier": "frontend"},
 	}
 
 	MergeConfig(configUser, configImage)
@@ -258,6 +261,12 @@ func TestMergeConfig(t *testing.T) {
 	if configUser.VolumesFrom != "1111" {
 		t.Fatalf("Expected VolumesFrom to be 1111, found %s", configUser.VolumesFrom)
 	}
+	if !configUser.Init {
+		t.Fatalf("Expected the init of the image to be kept")
+	}
+	if configUser.Labels["team"] != "payments" || configUser.Labels["tier"] != "frontend" {
+		t.Fatalf("Expected the labels team=payments and tier=frontend, found %v", configUser.Labels)
+	}
 }
 
 func TestMergeConfigPublicPortNotHonored(t *testing.T) {
@@ -318,3 +327,201 @@ func TestParseLxcConfOpt(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRestartPolicy(t *testing.T) {
+	valid := map[string]RestartPolicy{
+		"":             {},
+		"no":           {Name: "no"},
+		"always":       {Name: "always"},
+		"on-failure":   {Name: "on-failure"},
+		"on-failure:3": {Name: "on-failure", MaximumRetryCount: 3},
+	}
+	for policy, expected := range valid {
+		p, err := parseRestartPolicy(policy)
+		if err != nil {
+			t.Fatalf("Unable to parse %s: %s", policy, err)
+		}
+		if p != expected {
+			t.Fatalf("Expected %v for %s, found %v", expected, policy, p)
+		}
+	}
+	for _, policy := range []string{"sometimes", "always:3", "on-failure:-1", "on-failure:x"} {
+		if _, err := parseRestartPolicy(policy); err == nil {
+			t.Fatalf("Parsing %s should have failed", policy)
+		}
+	}
+}
+
+func TestParseLink(t *testing.T) {
+	name, alias, err := parseLink("db:database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "db" || alias != "database" {
+		t.Fatalf("Expected db and database, found %s and %s", name, alias)
+	}
+	for _, link := range []string{"db", ":db", "db:", "db:a:b", "db:-db"} {
+		if _, _, err := parseLink(link); err == nil {
+			t.Fatalf("Parsing %s should have failed", link)
+		}
+	}
+}
+
+func TestParseUlimit(t *testing.T) {
+	for value, expected := range map[string]Ulimit{
+		"nofile=1024":      {"nofile", 1024, 1024},
+		"nproc=512:1024":   {"nproc", 512, 1024},
+		"core=0:unlimited": {},
+		"nofile=2048:1024": {},
+		"files=1024":       {},
+		"nofile":           {},
+		"nofile=-1":        {},
+	} {
+		ulimit, err := parseUlimit(value)
+		if expected.Name == "" {
+			if err == nil {
+				t.Fatalf("Parsing %s should have failed", value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ulimit != expected {
+			t.Fatalf("Expected %v for %s, found %v", expected, value, ulimit)
+		}
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	for value, expected := range map[string]DeviceMapping{
+		"/dev/fuse":               {"/dev/fuse", "/dev/fuse", "rwm"},
+		"/dev/ttyUSB0:/dev/ttyS0": {"/dev/ttyUSB0", "/dev/ttyS0", "rwm"},
+		"/dev/sdb:/dev/xvdb:r":    {"/dev/sdb", "/dev/xvdb", "r"},
+		"/dev/snd/timer::rw":      {"/dev/snd/timer", "/dev/snd/timer", "rw"},
+	} {
+		device, err := parseDevice(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if device != expected {
+			t.Fatalf("Expected %v for %s, found %v", expected, value, device)
+		}
+	}
+	for _, value := range []string{"", "fuse", "/dev/fuse:fuse", "/dev/fuse:/dev/fuse:", "/dev/fuse:/dev/fuse:rwx", "/dev/fuse:/dev/fuse:rr", "/dev/fuse:/:rwm", "/dev/a:/dev/b:r:w", "/dev/fuse:/fuse", "/dev/fuse:/dev", "/dev/fuse:/dev/../etc/fuse"} {
+		if _, err := parseDevice(value); err == nil {
+			t.Fatalf("Parsing %s should have failed", value)
+		}
+	}
+}
+
+func TestParseTmpfs(t *testing.T) {
+	for value, expected := range map[string][2]string{
+		"/run":                    {"/run", ""},
+		"/run/":                   {"/run", ""},
+		"/tmp:size=64m,mode=1777": {"/tmp", "size=64m,mode=1777"},
+	} {
+		tmpfsPath, options, err := parseTmpfs(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpfsPath != expected[0] || options != expected[1] {
+			t.Fatalf("Expected %v for %s, found %s and %s", expected, value, tmpfsPath, options)
+		}
+	}
+	for _, value := range []string{"", "run", "/", "/:size=64m"} {
+		if _, _, err := parseTmpfs(value); err == nil {
+			t.Fatalf("Parsing %s should have failed", value)
+		}
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels([]string{"team=payments", "release=", "canary", "url=http://a/?b=c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 4 || labels["team"] != "payments" || labels["release"] != "" || labels["canary"] != "" || labels["url"] != "http://a/?b=c" {
+		t.Fatalf("Unexpected labels: %v", labels)
+	}
+	if _, err := parseLabels([]string{"=payments"}); err == nil {
+		t.Fatalf("Parsing =payments should have failed")
+	}
+}
+
+func TestFiltersMatchLabels(t *testing.T) {
+	filters, err := parseFilters(`{"label": ["team=payments", "canary"]}`, "label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filters.matchLabels(map[string]string{"team": "payments", "canary": "", "tier": "backend"}) {
+		t.Fatalf("Expected the labels to match %v", filters)
+	}
+	for _, labels := range []map[string]string{nil, {"team": "payments"}, {"team": "search", "canary": ""}} {
+		if filters.matchLabels(labels) {
+			t.Fatalf("Expected %v not to match %v", labels, filters)
+		}
+	}
+	if _, err := parseFilters(`{"status": ["running"]}`, "label"); err == nil {
+		t.Fatalf("Expected the status filter to be invalid")
+	}
+	if _, err := parseFilters(`label=team`, "label"); err == nil {
+		t.Fatalf("Expected filters not in JSON to be invalid")
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	filters, err := parseFilters(`{"status": ["exited", "paused"], "exited": ["137"], "name": ["web-*"], "created-after": ["1374067924"]}`, containerFilters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters["status"]) != 2 || filters["exited"][0] != "137" {
+		t.Fatalf("Unexpected filters: %v", filters)
+	}
+	for _, value := range []string{
+		`{"status": ["stopped"]}`,
+		`{"exited": ["-"]}`,
+		`{"name": ["web-["]}`,
+		`{"created-before": ["yesterday"]}`,
+		`{"dangling": ["true"]}`,
+	} {
+		if _, err := parseFilters(value, containerFilters...); err == nil {
+			t.Fatalf("Parsing %s should have failed", value)
+		}
+	}
+	if _, err := parseFilters(`{"dangling": ["yes"]}`, imageFilters...); err == nil {
+		t.Fatalf("Expected dangling to take a boolean")
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for value, expected := range map[string]int{"SIGQUIT": 3, "quit": 3, "3": 3, "SIGKILL": 9, "Term": 15, "34": 34} {
+		sig, err := parseSignal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig != expected {
+			t.Fatalf("Expected %d for %s, found %d", expected, value, sig)
+		}
+	}
+	for _, value := range []string{"", "SIG", "SIGFOO", "0", "-9", "65"} {
+		if _, err := parseSignal(value); err == nil {
+			t.Fatalf("Parsing %s should have failed", value)
+		}
+	}
+}
+
+func TestParseThrottleDevice(t *testing.T) {
+	device, err := parseThrottleDevice("/dev/sda:1048576")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Path != "/dev/sda" || device.Rate != 1048576 {
+		t.Fatalf("Unexpected device rate: %v", device)
+	}
+	for _, value := range []string{"/dev/sda", "sda:1048576", "/dev/sda:0", "/dev/sda:1M", "/dev/sda:1:2"} {
+		if _, err := parseThrottleDevice(value); err == nil {
+			t.Fatalf("Parsing %s should have failed", value)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package docker
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+func init() {
+	registerGraphDriver("vfs", func() (GraphDriver, error) {
+		return &vfsDriver{}, nil
+	})
+}
+
+// vfsDriver needs no kernel support at all: it copies every layer into the
+// target directory on Mount, and computes the read-write layer back from the
+// target on Unmount. Layers are stored in the AUFS format.
+// It is slow and uses a lot of disk space, but works everywhere.
+type vfsDriver struct {
+}
+
+func (d *vfsDriver) Name() string {
+	return "vfs"
+}
+
+func (d *vfsDriver) Create(layer string, data Archive) error {
+	return untarLayer(layer, data)
+}
+
+func (d *vfsDriver) Mount(layers []string, rw, target string) error {
+	// Whatever a failed mount or unmount left behind is stale
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	if err := d.mount(layers, rw, target); err != nil {
+		os.RemoveAll(target)
+		return err
+	}
+	return ioutil.WriteFile(mountMarker(target), nil, 0600)
+}
+
+func (d *vfsDriver) mount(layers []string, rw, target string) error {
+	for i := len(layers) - 1; i >= 0; i-- {
+		if err := applyLayer(layers[i], target); err != nil {
+			return err
+		}
+	}
+	return applyLayer(rw, target)
+}
+
+func (d *vfsDriver) Unmount(layers []string, rw, target string) error {
+	if mounted, err := d.Mounted(target); err != nil || !mounted {
+		return err
+	}
+	if err := diffLayers(layers, target, rw); err != nil {
+		return err
+	}
+	// Forget the mount before removing the copy, so that a partial removal
+	// is never taken for a mounted target
+	if err := os.Remove(mountMarker(target)); err != nil {
+		return err
+	}
+	return os.RemoveAll(target)
+}
+
+// A target is mounted once Mount has written its marker, which lives next
+// to the target so that it doesn't show up in the container.
+func (d *vfsDriver) Mounted(target string) (bool, error) {
+	if _, err := os.Stat(mountMarker(target)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func mountMarker(target string) string {
+	return filepath.Clean(target) + ".mounted"
+}
+
+func (d *vfsDriver) Diff(layers []string, rw, target string) (Archive, error) {
+	if err := d.sync(layers, rw, target); err != nil {
+		return nil, err
+	}
+	return Tar(rw, Uncompressed)
+}
+
+func (d *vfsDriver) Changes(layers []string, rw, target string) ([]Change, error) {
+	if err := d.sync(layers, rw, target); err != nil {
+		return nil, err
+	}
+	return Changes(layers, rw)
+}
+
+func (d *vfsDriver) Size(layers []string, rw, target string) (int64, error) {
+	if err := d.sync(layers, rw, target); err != nil {
+		return 0, err
+	}
+	return dirSize(rw)
+}
+
+// sync brings rw up to date with the changes made in target while it is
+// mounted, which otherwise only reach rw on Unmount.
+func (d *vfsDriver) sync(layers []string, rw, target string) error {
+	if target == "" {
+		return nil
+	}
+	if mounted, err := d.Mounted(target); err != nil || !mounted {
+		return err
+	}
+	return diffLayers(layers, target, rw)
+}
+
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(name, ".wh.")
+}
+
+// AUFS metadata, such as .wh..wh.aufs or .wh..wh.plnk
+func isWhiteoutMeta(name string) bool {
+	return strings.HasPrefix(name, ".wh..wh.")
+}
+
+// applyLayer copies the layer src on top of dst, honoring whiteouts.
+func applyLayer(src, dst string) error {
+	// Hardlinks within the layer are kept as hardlinks
+	inodes := make(map[uint64]string)
+	var dirs []string
+
+	err := filepath.Walk(src, func(pth string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, pth)
+		if err != nil {
+			return err
+		}
+		name := f.Name()
+		if isWhiteoutMeta(name) {
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isWhiteout(name) {
+			return os.RemoveAll(filepath.Join(dst, filepath.Dir(rel), name[len(".wh."):]))
+		}
+		target := filepath.Join(dst, rel)
+
+		if f.IsDir() {
+			dirs = append(dirs, rel)
+			if fi, err := os.Lstat(target); err == nil && fi.IsDir() {
+				return copyMetadata(f, target)
+			}
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+		stat := f.Sys().(*syscall.Stat_t)
+		if !f.IsDir() && stat.Nlink > 1 {
+			if first, exists := inodes[uint64(stat.Ino)]; exists {
+				return os.Link(first, target)
+			}
+			inodes[uint64(stat.Ino)] = target
+		}
+		return copyEntry(pth, target, f)
+	})
+	if err != nil {
+		return err
+	}
+	// Creating entries changes the mtime of their parents: restore them last
+	for i := len(dirs) - 1; i >= 0; i-- {
+		f, err := os.Lstat(filepath.Join(src, dirs[i]))
+		if err != nil {
+			return err
+		}
+		if err := os.Chtimes(filepath.Join(dst, dirs[i]), f.ModTime(), f.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyEntry creates dst as a copy of the file, directory, symlink or device
+// src, which must not exist yet.
+func copyEntry(src, dst string, f os.FileInfo) error {
+	stat := f.Sys().(*syscall.Stat_t)
+	switch mode := f.Mode(); {
+	case mode.IsDir():
+		if err := os.Mkdir(dst, f.Mode().Perm()); err != nil {
+			return err
+		}
+	case mode&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(link, dst); err != nil {
+			return err
+		}
+		return os.Lchown(dst, int(stat.Uid), int(stat.Gid))
+	case mode.IsRegular():
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+	default:
+		// Devices, fifos and sockets
+		if err := syscall.Mknod(dst, uint32(stat.Mode), int(stat.Rdev)); err != nil {
+			return err
+		}
+	}
+	return copyMetadata(f, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyMetadata applies the ownership, permissions and mtime of f to dst,
+// which must not be a symlink.
+func copyMetadata(f os.FileInfo, dst string) error {
+	stat := f.Sys().(*syscall.Stat_t)
+	if err := os.Lchown(dst, int(stat.Uid), int(stat.Gid)); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	// Chmod after chown, which clears the setuid bits
+	if err := os.Chmod(dst, f.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, f.ModTime(), f.ModTime())
+}
+
+// diffLayers replaces the content of rw with the differences between the
+// read-only layers and the directory target, in the AUFS format.
+func diffLayers(layers []string, target, rw string) error {
+	lower, err := indexLayers(layers)
+	if err != nil {
+		return err
+	}
+
+	// Start from an empty read-write layer
+	entries, err := ioutil.ReadDir(rw)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(rw, entry.Name())); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(rw, 0755); err != nil {
+		return err
+	}
+
+	inodes := make(map[uint64]string)
+	var dirs []string
+	// Directories of rw created to hold a change, from target
+	created := make(map[string]bool)
+	ensureParent := func(rel string) error {
+		parent := filepath.Dir(rel)
+		if parent == "." || created[parent] {
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(rw, parent)); err == nil {
+			return nil
+		}
+		var missing []string
+		for dir := parent; dir != "."; dir = filepath.Dir(dir) {
+			if _, err := os.Lstat(filepath.Join(rw, dir)); err == nil {
+				break
+			}
+			missing = append([]string{dir}, missing...)
+		}
+		for _, dir := range missing {
+			f, err := os.Lstat(filepath.Join(target, dir))
+			if err != nil {
+				return err
+			}
+			if err := copyEntry(filepath.Join(target, dir), filepath.Join(rw, dir), f); err != nil {
+				return err
+			}
+			created[dir] = true
+			dirs = append(dirs, dir)
+		}
+		return nil
+	}
+
+	err = filepath.Walk(target, func(pth string, f os.FileInfo, err error) error {
+		if err != nil {
+			// The container may be running and removing files meanwhile
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(target, pth)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if l, exists := lower[rel]; exists {
+			l.seen = true
+			if !entryChanged(l.info, f) {
+				return nil
+			}
+		}
+		if err := ensureParent(rel); err != nil {
+			return err
+		}
+		dst := filepath.Join(rw, rel)
+		if f.IsDir() {
+			if created[rel] {
+				return nil
+			}
+			created[rel] = true
+			dirs = append(dirs, rel)
+		}
+		stat := f.Sys().(*syscall.Stat_t)
+		if !f.IsDir() && stat.Nlink > 1 {
+			if first, exists := inodes[uint64(stat.Ino)]; exists {
+				return os.Link(first, dst)
+			}
+			inodes[uint64(stat.Ino)] = dst
+		}
+		if err := copyEntry(pth, dst, f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Whiteout whatever disappeared, unless its parent disappeared as well
+	for rel, l := range lower {
+		if l.seen {
+			continue
+		}
+		if parent, exists := lower[filepath.Dir(rel)]; exists && !parent.seen {
+			continue
+		}
+		// The parent directory was replaced by a file, which hides it already
+		if f, err := os.Lstat(filepath.Join(target, filepath.Dir(rel))); err == nil && !f.IsDir() {
+			continue
+		}
+		if err := ensureParent(rel); err != nil {
+			return err
+		}
+		whiteout := filepath.Join(rw, filepath.Dir(rel), ".wh."+filepath.Base(rel))
+		if err := ioutil.WriteFile(whiteout, []byte{}, 0600); err != nil {
+			return err
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		f, err := os.Lstat(filepath.Join(target, dirs[i]))
+		if err != nil {
+			return err
+		}
+		if err := os.Chtimes(filepath.Join(rw, dirs[i]), f.ModTime(), f.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type layerEntry struct {
+	info os.FileInfo
+	seen bool
+}
+
+// indexLayers returns the entries visible through the stack of layers,
+// indexed by their path relative to the root.
+func indexLayers(layers []string) (map[string]*layerEntry, error) {
+	index := make(map[string]*layerEntry)
+	removeTree := func(rel string) {
+		delete(index, rel)
+		prefix := rel + "/"
+		for p := range index {
+			if strings.HasPrefix(p, prefix) {
+				delete(index, p)
+			}
+		}
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		err := filepath.Walk(layer, func(pth string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(layer, pth)
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			name := f.Name()
+			if isWhiteoutMeta(name) {
+				if f.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isWhiteout(name) {
+				removeTree(filepath.Join(filepath.Dir(rel), name[len(".wh."):]))
+				return nil
+			}
+			// A file hides the whole tree of a directory below it
+			if l, exists := index[rel]; exists && (!f.IsDir() || !l.info.IsDir()) {
+				removeTree(rel)
+			}
+			index[rel] = &layerEntry{info: f}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+func entryChanged(old, new os.FileInfo) bool {
+	oldStat := old.Sys().(*syscall.Stat_t)
+	newStat := new.Sys().(*syscall.Stat_t)
+	if old.Mode() != new.Mode() || oldStat.Uid != newStat.Uid || oldStat.Gid != newStat.Gid {
+		return true
+	}
+	if old.IsDir() {
+		// The content of directories is compared entry by entry
+		return false
+	}
+	return old.Size() != new.Size() || !old.ModTime().Equal(new.ModTime()) || oldStat.Rdev != newStat.Rdev
+}
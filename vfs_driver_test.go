@@ -0,0 +1,142 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+)
+
+func TestVfsDriver(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-vfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	base := path.Join(tmp, "base")
+	top := path.Join(tmp, "top")
+	rw := path.Join(tmp, "rw")
+	rootfs := path.Join(tmp, "rootfs")
+	writeFile(path.Join(base, "etc/passwd"), "root", t)
+	writeFile(path.Join(base, "etc/hosts"), "localhost", t)
+	writeFile(path.Join(base, "bin/sh"), "sh", t)
+	writeFile(path.Join(top, "etc/motd"), "hello", t)
+	writeFile(path.Join(top, ".wh.bin"), "", t)
+	if err := os.MkdirAll(rw, 0755); err != nil {
+		t.Fatal(err)
+	}
+	layers := []string{top, base}
+
+	driver := &vfsDriver{}
+	if err := driver.Mount(layers, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+	if mounted, err := driver.Mounted(rootfs); err != nil || !mounted {
+		t.Fatalf("%s should be mounted (%v)", rootfs, err)
+	}
+	if content := readFile(path.Join(rootfs, "etc/motd"), t); content != "hello" {
+		t.Fatalf("Expected the top layer in the rootfs, found %s", content)
+	}
+	if _, err := os.Stat(path.Join(rootfs, "bin")); !os.IsNotExist(err) {
+		t.Fatalf("/bin should have been removed by the whiteout of the top layer")
+	}
+
+	// Make some changes
+	if err := os.Remove(path.Join(rootfs, "etc/passwd")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(path.Join(rootfs, "etc/hosts"), "127.0.0.1 localhost", t)
+	writeFile(path.Join(rootfs, "tmp/foo"), "bar", t)
+
+	// Changes are visible while the container runs
+	expected := []string{"A /tmp", "A /tmp/foo", "C /etc", "C /etc/hosts", "D /etc/passwd"}
+	checkDriverChanges(driver, layers, rw, rootfs, expected, t)
+
+	if err := driver.Unmount(layers, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+	if mounted, err := driver.Mounted(rootfs); err != nil || mounted {
+		t.Fatalf("%s should not be mounted anymore (%v)", rootfs, err)
+	}
+	checkDriverChanges(driver, layers, rw, rootfs, expected, t)
+
+	// Mounting again brings the changes back
+	if err := driver.Mount(layers, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(rootfs, "etc/passwd")); !os.IsNotExist(err) {
+		t.Fatalf("/etc/passwd should have been removed")
+	}
+	if content := readFile(path.Join(rootfs, "tmp/foo"), t); content != "bar" {
+		t.Fatalf("Expected /tmp/foo to contain bar, found %s", content)
+	}
+}
+
+// Whether a target is mounted doesn't depend on what it holds
+func TestVfsDriverMounted(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-vfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	empty := path.Join(tmp, "empty")
+	rw := path.Join(tmp, "rw")
+	rootfs := path.Join(tmp, "rootfs")
+	for _, dir := range []string{empty, rw} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Left behind by an interrupted unmount
+	writeFile(path.Join(rootfs, "etc/passwd"), "root", t)
+
+	driver := &vfsDriver{}
+	if mounted, err := driver.Mounted(rootfs); err != nil || mounted {
+		t.Fatalf("%s should not be mounted (%v)", rootfs, err)
+	}
+	if err := driver.Unmount([]string{empty}, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(rw, "etc")); !os.IsNotExist(err) {
+		t.Fatalf("Unmounting a target that isn't mounted shouldn't change the rw layer")
+	}
+
+	if err := driver.Mount([]string{empty}, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(rootfs, "etc")); !os.IsNotExist(err) {
+		t.Fatalf("Mount should have removed the stale content of %s", rootfs)
+	}
+	if mounted, err := driver.Mounted(rootfs); err != nil || !mounted {
+		t.Fatalf("An empty %s should be mounted (%v)", rootfs, err)
+	}
+	if err := driver.Unmount([]string{empty}, rw, rootfs); err != nil {
+		t.Fatal(err)
+	}
+	if mounted, err := driver.Mounted(rootfs); err != nil || mounted {
+		t.Fatalf("%s should not be mounted anymore (%v)", rootfs, err)
+	}
+}
+
+func checkDriverChanges(driver GraphDriver, layers []string, rw, rootfs string, expected []string, t *testing.T) {
+	changes, err := driver.Changes(layers, rw, rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, change := range changes {
+		actual = append(actual, change.String())
+	}
+	sort.Strings(actual)
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected changes %v, found %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Expected changes %v, found %v", expected, actual)
+		}
+	}
+}